@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached response, saved in a JSON file.
+type cacheEntry struct {
+	URL      string      `json:"url"`
+	ETag     string      `json:"etag,omitempty"`
+	StoredAt time.Time   `json:"stored-at"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+}
+
+// response returns the cached response of the request.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// diskCache saves the entries in a directory, one JSON file per key.
+type diskCache struct {
+	dir string
+}
+
+func (c *diskCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *diskCache) get(key string) (*cacheEntry, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	// A broken or colliding entry is a miss, and is overwritten later.
+	if err = json.Unmarshal(data, &e); err != nil || e.URL != key {
+		return nil, false
+	}
+	return &e, true
+}
+
+func (c *diskCache) put(e *cacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a broken entry,
+	// the file is unique because the same key may be saved in parallel.
+	tmp, err := ioutil.TempFile(c.dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(e.URL))
+}
+
+// prune removes the entries saved before the time, and the temporary files
+// left by a crash.
+func (c *diskCache) prune(before time.Time) error {
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if file.ModTime().Before(before) {
+			if err = os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cachingTransport caches the responses of the GET requests matching the
+// path prefixes. The URL is the key, which holds the query and the time
+// window of the search, so the entries expired for the TTL are pruned at
+// most once a TTL.
+type cachingTransport struct {
+	cache    *diskCache
+	ttl      time.Duration
+	prefixes []string
+	base     http.RoundTripper
+
+	mu        sync.Mutex
+	lastPrune time.Time
+
+	now func() time.Time
+}
+
+func newCachingTransport(cache *diskCache, ttl time.Duration, base http.RoundTripper, prefixes ...string) *cachingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cachingTransport{
+		cache:    cache,
+		ttl:      ttl,
+		prefixes: prefixes,
+		base:     base,
+		now:      time.Now,
+	}
+}
+
+func (t *cachingTransport) cachable(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	for _, prefix := range t.prefixes {
+		if strings.Contains(req.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.cachable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	entry, ok := t.cache.get(key)
+	if ok && t.now().Sub(entry.StoredAt) < t.ttl {
+		return entry.response(req), nil
+	}
+	if ok && len(entry.ETag) > 0 {
+		// The request must not be modified by a RoundTripper.
+		req = req.WithContext(req.Context())
+		req.Header = cloneHeader(req.Header)
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		resp.Body.Close()
+		entry.StoredAt = t.now()
+		t.save(entry)
+		return entry.response(req), nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		header := cloneHeader(resp.Header)
+		// The rate limit of an old response misleads the client.
+		for name := range header {
+			if strings.HasPrefix(name, "X-Ratelimit-") {
+				header.Del(name)
+			}
+		}
+		t.save(&cacheEntry{
+			URL:      key,
+			ETag:     resp.Header.Get("ETag"),
+			StoredAt: t.now(),
+			Header:   header,
+			Body:     body,
+		})
+	}
+	return resp, nil
+}
+
+// save saves the entry, the cache is only an optimization so the error is
+// printed and ignored.
+func (t *cachingTransport) save(e *cacheEntry) {
+	if err := t.cache.put(e); err != nil {
+		fmt.Printf("save cache of %s failed %v\n", e.URL, err)
+	}
+
+	now := t.now()
+	t.mu.Lock()
+	prune := now.Sub(t.lastPrune) >= t.ttl
+	if prune {
+		t.lastPrune = now
+	}
+	t.mu.Unlock()
+	if prune {
+		if err := t.cache.prune(now.Add(-t.ttl)); err != nil {
+			fmt.Printf("prune cache %s failed %v\n", t.cache.dir, err)
+		}
+	}
+}
+
+func cloneHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// newCachingTransports creates the caching transports of GitHub and Jira,
+// they are nil if the cache is disabled.
+func newCachingTransports(cfg Cache) (githubTransport http.RoundTripper, jiraTransport http.RoundTripper) {
+	if cfg.Disable || len(cfg.Dir) == 0 {
+		return nil, nil
+	}
+	// The TTLs are validated in Config.adjust.
+	githubTTL, _ := time.ParseDuration(cfg.GithubTTL)
+	jiraTTL, _ := time.ParseDuration(cfg.JiraTTL)
+
+	// Only the searches and the reads of the issues are cached, the sprints
+	// are always loaded because the rotation changes them.
+	githubTransport = newCachingTransport(&diskCache{dir: filepath.Join(cfg.Dir, "github")}, githubTTL, nil,
+		"/search/", "/pulls/")
+	jiraTransport = newCachingTransport(&diskCache{dir: filepath.Join(cfg.Dir, "jira")}, jiraTTL, nil,
+		"/rest/api/2/search", "/rest/api/2/issue/", "/rest/api/2/field")
+	return githubTransport, jiraTransport
+}
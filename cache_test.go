@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestCachingTransport(t *testing.T) {
+	var requests []*http.Request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Write([]byte("body of " + r.URL.RawQuery))
+	}))
+	defer s.Close()
+
+	now := time.Date(2018, 10, 5, 8, 0, 0, 0, time.UTC)
+	transport := newCachingTransport(&diskCache{dir: t.TempDir()}, time.Minute, nil, "/search/")
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func(path string) string {
+		resp, err := client.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", path, resp.StatusCode)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The first request is sent and cached, the second one is in the TTL.
+	for i := 0; i < 2; i++ {
+		if body := get("/search/issues?q=a"); body != "body of q=a" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expect 1 request, got %d", len(requests))
+	}
+
+	// Another query is another key.
+	get("/search/issues?q=b")
+	if len(requests) != 2 {
+		t.Fatalf("expect 2 requests, got %d", len(requests))
+	}
+
+	// The expired entry is revalidated with ETag.
+	now = now.Add(2 * time.Minute)
+	if body := get("/search/issues?q=a"); body != "body of q=a" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if len(requests) != 3 || requests[2].Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("expect a conditional request, got %v", requests[len(requests)-1].Header)
+	}
+
+	// The paths not matching the prefixes are never cached.
+	get("/repos/tikv/tikv")
+	get("/repos/tikv/tikv")
+	if len(requests) != 5 {
+		t.Fatalf("expect 5 requests, got %d", len(requests))
+	}
+
+	entry, ok := transport.cache.get(s.URL + "/search/issues?q=a")
+	if !ok || !entry.StoredAt.Equal(now) || len(entry.Header.Get("X-RateLimit-Remaining")) > 0 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+}
+
+func TestCachingTransportsDisabled(t *testing.T) {
+	cfg := Cache{Dir: t.TempDir(), Disable: true, GithubTTL: "10m", JiraTTL: "10m"}
+	if g, j := newCachingTransports(cfg); g != nil || j != nil {
+		t.Fatal("expect no cache when disabled")
+	}
+}
+
+func TestJiraFreshSearchBypassesCache(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(fmt.Sprintf(`{"total": 1, "issues": [{"id": "%d", "key": "TIKV-%d"}]}`, requests, requests)))
+	}))
+	defer s.Close()
+
+	cache := newCachingTransport(&diskCache{dir: t.TempDir()}, time.Hour, nil, "/rest/api/2/search")
+	service, err := newJiraService(Jira{Endpoint: s.URL + "/"}, cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := func(opts jiraSearchOptions) string {
+		var key string
+		err := service.SearchIssues("Sprint = 1", opts, func(issue jira.Issue) error {
+			key = issue.Key
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	search(jiraSearchOptions{})
+	if key := search(jiraSearchOptions{}); key != "TIKV-1" {
+		t.Fatalf("expect the cached issue, got %s", key)
+	}
+	if key := search(jiraSearchOptions{Fresh: true}); key != "TIKV-2" || requests != 2 {
+		t.Fatalf("expect the issue loaded from Jira, got %s with %d requests", key, requests)
+	}
+}
+
+func TestCachingTransportPrunes(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer s.Close()
+
+	now := time.Now()
+	transport := newCachingTransport(&diskCache{dir: t.TempDir()}, time.Hour, nil, "/search/")
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+	get := func(path string) {
+		resp, err := client.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	expire := func(path string) {
+		old := now.Add(-2 * time.Hour)
+		if err := os.Chtimes(transport.cache.path(s.URL+path), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func(path string) bool {
+		_, ok := transport.cache.get(s.URL + path)
+		return ok
+	}
+
+	get("/search/issues?q=a")
+	expire("/search/issues?q=a")
+
+	// The expired entry is kept until a TTL passes since the last pruning.
+	get("/search/issues?q=b")
+	if !cached("/search/issues?q=a") {
+		t.Fatal("expect no pruning in the TTL")
+	}
+
+	now = now.Add(time.Hour)
+	expire("/search/issues?q=a")
+	get("/search/issues?q=c")
+	if cached("/search/issues?q=a") || !cached("/search/issues?q=b") || !cached("/search/issues?q=c") {
+		t.Fatal("expect only the expired entry pruned")
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -10,6 +12,10 @@ type Slack struct {
 	Token   string `toml:"token"`
 	Channel string `toml:"channel"`
 	User    string `toml:"user"`
+	// Endpoint overrides the Slack Web API URL, default https://slack.com/api/
+	Endpoint string `toml:"endpoint"`
+	// PlainText sends the reports as one plain text message instead of Block Kit.
+	PlainText bool `toml:"plain-text"`
 }
 
 type Jira struct {
@@ -20,6 +26,21 @@ type Jira struct {
 	Server   string `toml:"server"`
 	Project  string `toml:"project"`
 	OnCall   string `toml:"oncall"`
+
+	// OnCalls at or above the priority are urgent, and the urgent ones not
+	// updated for the inactive days are inactive.
+	OnCallPriority     string `toml:"oncall-priority"`
+	OnCallInactiveDays int    `toml:"oncall-inactive-days"`
+
+	Fields JiraFields `toml:"fields"`
+}
+
+// JiraFields are the IDs of the custom fields, like "customfield_10100".
+// The ones not set are discovered by the field names.
+type JiraFields struct {
+	EpicLink      string `toml:"epic-link"`
+	EpicName      string `toml:"epic-name"`
+	Collaborators string `toml:"collaborators"`
 }
 
 type Member struct {
@@ -28,14 +49,23 @@ type Member struct {
 	Email  string `json:"email"`
 }
 
+// Team is a team of the members. A team with a Slack channel gets its own
+// daily report in the channel, for its repos and Jira project, or the global
+// ones if not set.
 type Team struct {
 	Name    string   `json:"name"`
 	Members []Member `json:"members"`
+	Repos   []string `json:"repos"`
+	Project string   `json:"project"`
+	Channel string   `json:"channel"`
+	OnCall  string   `json:"oncall"`
 }
 
 type Github struct {
 	Token string   `json:"token"`
 	Repos []string `json:"repos"`
+	// Endpoint overrides the GitHub API URL, e.g, for GitHub Enterprise.
+	Endpoint string `json:"endpoint"`
 }
 
 type Confluence struct {
@@ -45,6 +75,89 @@ type Confluence struct {
 
 	Space      string `toml:"space"`
 	WeeklyPath string `toml:"weekly-path"`
+	// JiraSnapshot renders the Jira issues of the report as a static table
+	// at the generation time, "static" replaces the live Jira macros and
+	// "both" keeps them after the table. Empty uses the live macros only.
+	JiraSnapshot string `toml:"jira-snapshot"`
+}
+
+const (
+	jiraSnapshotStatic = "static"
+	jiraSnapshotBoth   = "both"
+)
+
+// DailySection is a section of the daily report. It lists either the GitHub
+// issues matching the search qualifiers or the Jira issues matching the JQL.
+//
+// A GitHub qualifier value like ">=-24h" or "<-72h" is relative to now.
+// OnCall can be "new" or "inactive" to list the OnCalls of the configured
+// OnCall project instead of writing the JQL. The "{project}" in the JQL is
+// replaced with the Jira project of the team.
+type DailySection struct {
+	Title       string            `toml:"title"`
+	Description string            `toml:"description"`
+	Github      map[string]string `toml:"github"`
+	Sort        string            `toml:"sort"`
+	Community   bool              `toml:"community"`
+	JQL         string            `toml:"jql"`
+	OnCall      string            `toml:"oncall"`
+}
+
+const (
+	dailyOnCallNew      = "new"
+	dailyOnCallInactive = "inactive"
+)
+
+type Daily struct {
+	Sections []DailySection `toml:"sections"`
+}
+
+// Duty is the duty roster. The members, in GitHub logins of the team
+// members, take the duty in turn, Size of them in each sprint from the
+// sprint starting at Start.
+type Duty struct {
+	Members []string `toml:"members"`
+	Size    int      `toml:"size"`
+	Start   string   `toml:"start"`
+}
+
+// Triage configures the triage assign command. Owners maps the path
+// prefixes to the GitHub logins owning them, like CODEOWNERS, and a PR is
+// assigned to the owner of most of its changed files.
+type Triage struct {
+	Owners map[string]string `toml:"owners"`
+}
+
+// Serve configures the schedules of the serve command. Every schedule is a
+// five-field cron expression in the timezone, and an empty one is disabled.
+type Serve struct {
+	Timezone     string `toml:"timezone"`
+	StateFile    string `toml:"state-file"`
+	Daily        string `toml:"daily"`
+	WeeklyReport string `toml:"weekly-report"`
+	RotateSprint string `toml:"rotate-sprint"`
+}
+
+// Sprint configures the sprint rotation. A sprint lasts 1 to 4 weeks and
+// starts at 00:00 on the weekday in the timezone, the name is a Go template
+// of the fields in sprintNameData. The steps of the rotation are recorded
+// in the journal, so a rotation which dies halfway is resumed.
+type Sprint struct {
+	Weeks    int    `toml:"weeks"`
+	Weekday  string `toml:"weekday"`
+	Timezone string `toml:"timezone"`
+	Name     string `toml:"name"`
+	Journal  string `toml:"journal"`
+}
+
+// Cache configures the on-disk cache of the GitHub and Jira queries. A
+// cached response is used without a request within the TTL of the source,
+// and the GitHub ones are revalidated with ETag after that.
+type Cache struct {
+	Dir       string `toml:"dir"`
+	Disable   bool   `toml:"disable"`
+	GithubTTL string `toml:"github-ttl"`
+	JiraTTL   string `toml:"jira-ttl"`
 }
 
 type Config struct {
@@ -53,6 +166,126 @@ type Config struct {
 	Confluence Confluence `toml:"confluence"`
 	Github     Github     `toml:"github"`
 	Teams      []Team     `toml:"teams"`
+	Daily      Daily      `toml:"daily"`
+	Duty       Duty       `toml:"duty"`
+	Triage     Triage     `toml:"triage"`
+	Serve      Serve      `toml:"serve"`
+	Sprint     Sprint     `toml:"sprint"`
+	Cache      Cache      `toml:"cache"`
+
+	// The max number of the concurrent queries to GitHub and Jira.
+	Concurrency int `toml:"concurrency"`
+}
+
+func defaultDailySections(j Jira) []DailySection {
+	return []DailySection{
+		{
+			Title:       "New Issues",
+			Description: "New issues in last 24 hours",
+			Github:      map[string]string{"is": "issue", "created": ">=-24h"},
+		},
+		{
+			Title:       "New Pull Requests",
+			Description: "New PRs in last 24 hours",
+			Github:      map[string]string{"is": "pr", "created": ">=-24h"},
+		},
+		{
+			Title:       "New OnCalls",
+			Description: "New on calls in last 24 hours",
+			OnCall:      dailyOnCallNew,
+		},
+		{
+			Title:       "Inactive OnCalls",
+			Description: fmt.Sprintf("%s priority on calls inactive >= %d days", j.OnCallPriority, j.OnCallInactiveDays),
+			OnCall:      dailyOnCallInactive,
+		},
+	}
+}
+
+func (c *Config) adjust() error {
+	if len(c.Jira.OnCall) == 0 {
+		c.Jira.OnCall = "ONCALL"
+	}
+	if len(c.Jira.OnCallPriority) == 0 {
+		c.Jira.OnCallPriority = "Highest"
+	}
+	if c.Jira.OnCallInactiveDays <= 0 {
+		c.Jira.OnCallInactiveDays = 3
+	}
+
+	if c.Sprint.Weeks == 0 {
+		c.Sprint.Weeks = 1
+	}
+	if len(c.Sprint.Name) == 0 {
+		c.Sprint.Name = defaultSprintName
+	}
+	if err := c.Sprint.validate(); err != nil {
+		return err
+	}
+
+	// The duty start is checked in the sprint timezone, so after the sprint.
+	if len(c.Duty.Members) > 0 {
+		if c.Duty.Size <= 0 {
+			c.Duty.Size = 2
+		}
+		if c.Duty.Size > len(c.Duty.Members) {
+			c.Duty.Size = len(c.Duty.Members)
+		}
+		start, err := c.dutyStart()
+		if err != nil {
+			return fmt.Errorf("invalid duty start %q, must be like %s", c.Duty.Start, dayFormat)
+		}
+		if weekday, _ := parseWeekday(c.Sprint.Weekday); len(c.Sprint.Weekday) > 0 && start.Weekday() != weekday {
+			return fmt.Errorf("invalid duty start %q, must be a %s when the sprints start", c.Duty.Start, weekday)
+		}
+	}
+
+	if c.Concurrency <= 0 {
+		c.Concurrency = 4
+	}
+
+	if len(c.Cache.GithubTTL) == 0 {
+		c.Cache.GithubTTL = "10m"
+	}
+	if len(c.Cache.JiraTTL) == 0 {
+		c.Cache.JiraTTL = "10m"
+	}
+	for _, ttl := range []string{c.Cache.GithubTTL, c.Cache.JiraTTL} {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			return fmt.Errorf("invalid cache ttl %q: %v", ttl, err)
+		}
+	}
+
+	switch c.Confluence.JiraSnapshot {
+	case "", jiraSnapshotStatic, jiraSnapshotBoth:
+	default:
+		return fmt.Errorf("invalid confluence jira-snapshot %q, must be %q or %q",
+			c.Confluence.JiraSnapshot, jiraSnapshotStatic, jiraSnapshotBoth)
+	}
+
+	if len(c.Daily.Sections) == 0 {
+		c.Daily.Sections = defaultDailySections(c.Jira)
+	}
+	for i := range c.Daily.Sections {
+		section := &c.Daily.Sections[i]
+		sources := 0
+		for _, set := range []bool{len(section.Github) > 0, len(section.JQL) > 0, len(section.OnCall) > 0} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("daily section %q must have one of github, jql or oncall", section.Title)
+		}
+		if len(section.OnCall) > 0 && section.OnCall != dailyOnCallNew && section.OnCall != dailyOnCallInactive {
+			return fmt.Errorf("daily section %q has invalid oncall %q, must be %q or %q",
+				section.Title, section.OnCall, dailyOnCallNew, dailyOnCallInactive)
+		}
+		if len(section.Sort) == 0 {
+			section.Sort = "created"
+		}
+	}
+	return nil
 }
 
 // NewConfigFromFile creates the configuration from file
@@ -65,6 +298,9 @@ func NewConfigFromFile(path string) (*Config, error) {
 	if err = toml.Unmarshal(data, c); err != nil {
 		return nil, err
 	}
+	if err = c.adjust(); err != nil {
+		return nil, err
+	}
 
 	return c, nil
 }
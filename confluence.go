@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
 	"reflect"
 
+	jira "github.com/andygrunwald/go-jira"
 	"github.com/google/go-querystring/query"
 )
 
@@ -56,7 +58,28 @@ func addOptions(s string, opt interface{}) (string, error) {
 	return u.String(), nil
 }
 
-func getContentByTitle(space string, title string) Content {
+// confluencePublisher is the PagePublisher backed by the Confluence REST API.
+type confluencePublisher struct {
+	client *jira.Client
+}
+
+// newConfluencePublisher creates the publisher sending the requests through
+// the transport, or the default one if it is nil.
+func newConfluencePublisher(cfg Confluence, base http.RoundTripper) (*confluencePublisher, error) {
+	// A little tricky here, both JIRA and Confluence use the same REST style.
+	transport := jira.BasicAuthTransport{
+		Username:  cfg.User,
+		Password:  cfg.Password,
+		Transport: base,
+	}
+	client, err := jira.NewClient(transport.Client(), cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &confluencePublisher{client: client}, nil
+}
+
+func (p *confluencePublisher) GetContentByTitle(space string, title string) (Content, error) {
 	opts := struct {
 		Title    string `url:"title"`
 		SpaceKey string `url:"spaceKey"`
@@ -69,39 +92,94 @@ func getContentByTitle(space string, title string) Content {
 
 	apiEndpoint := "rest/api/content"
 	url, err := addOptions(apiEndpoint, opts)
-	perror(err)
+	if err != nil {
+		return Content{}, err
+	}
 
-	req, err := conflunceClient.NewRequest("GET", url, nil)
-	perror(err)
+	req, err := p.client.NewRequest("GET", url, nil)
+	if err != nil {
+		return Content{}, err
+	}
 
 	res := struct {
 		Results []Content `json:"results"`
 	}{}
 
-	_, err = conflunceClient.Do(req, &res)
-	perror(err)
+	if _, err = p.client.Do(req, &res); err != nil {
+		return Content{}, err
+	}
 
 	if len(res.Results) == 0 {
-		return Content{}
+		return Content{}, nil
 	}
 
-	return res.Results[0]
+	return res.Results[0], nil
 }
 
-func getContent(id string) Content {
+func (p *confluencePublisher) GetContent(id string) (Content, error) {
 	apiEndpoint := fmt.Sprintf("rest/api/content/%s?expand=body.storage,version.number,space.key", id)
 
-	req, err := conflunceClient.NewRequest("GET", apiEndpoint, nil)
-	perror(err)
+	req, err := p.client.NewRequest("GET", apiEndpoint, nil)
+	if err != nil {
+		return Content{}, err
+	}
 
 	var content Content
-	_, err = conflunceClient.Do(req, &content)
-	perror(err)
+	if _, err = p.client.Do(req, &content); err != nil {
+		return Content{}, err
+	}
 
-	return content
+	return content, nil
 }
 
-func createContent(space string, parentID string, title string, value string) Content {
+func (p *confluencePublisher) CreateContent(content Content) (Content, error) {
+	apiEndpoint := "rest/api/content"
+
+	req, err := p.client.NewRequest("POST", apiEndpoint, &content)
+	if err != nil {
+		return Content{}, err
+	}
+
+	var respContent Content
+	if _, err = p.client.Do(req, &respContent); err != nil {
+		return Content{}, err
+	}
+	return respContent, nil
+}
+
+func (p *confluencePublisher) UpdateContent(content Content) (Content, error) {
+	apiEndpoint := "rest/api/content/" + content.Id
+
+	req, err := p.client.NewRequest("PUT", apiEndpoint, &content)
+	if err != nil {
+		return Content{}, err
+	}
+
+	var respContent Content
+	if _, err = p.client.Do(req, &respContent); err != nil {
+		return Content{}, err
+	}
+
+	return respContent, nil
+}
+
+func (p *confluencePublisher) DeleteContent(id string) error {
+	apiEndpoint := "rest/api/content/" + id
+
+	req, err := p.client.NewRequest("DELETE", apiEndpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.Do(req, nil)
+	return err
+}
+
+func (r *Reporter) getContentByTitle(space string, title string) (Content, error) {
+	return r.pages.GetContentByTitle(space, title)
+}
+
+func (r *Reporter) createContent(space string, parentID string, title string, value string) (Content, error) {
 	content := Content{
 		Type:  "page",
 		Title: title,
@@ -114,18 +192,15 @@ func createContent(space string, parentID string, title string, value string) Co
 	content.Body.Storage.Value = escaperValue(value)
 	content.Body.Storage.Representation = "storage"
 
-	apiEndpoint := "rest/api/content"
-
-	req, err := conflunceClient.NewRequest("POST", apiEndpoint, &content)
-	perror(err)
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("create confluence page %q in space %s under %q", title, space, parentID), content.Body.Storage.Value)
+		return content, nil
+	}
 
-	var respContent Content
-	_, err = conflunceClient.Do(req, &respContent)
-	perror(err)
-	return respContent
+	return r.pages.CreateContent(content)
 }
 
-func updateContent(content Content, value string) Content {
+func (r *Reporter) updateContent(content Content, value string) (Content, error) {
 	newContent := Content{
 		Id:    content.Id,
 		Type:  "page",
@@ -137,24 +212,10 @@ func updateContent(content Content, value string) Content {
 	newContent.Body.Storage.Representation = "storage"
 	newContent.Version.Number = content.Version.Number + 1
 
-	apiEndpoint := "rest/api/content/" + content.Id
-
-	req, err := conflunceClient.NewRequest("PUT", apiEndpoint, &newContent)
-	perror(err)
-
-	var respContent Content
-	_, err = conflunceClient.Do(req, &respContent)
-	perror(err)
-
-	return respContent
-}
-
-func deleteContent(id string) {
-	apiEndpoint := "rest/api/content/" + id
-
-	req, err := conflunceClient.NewRequest("DELETE", apiEndpoint, nil)
-	perror(err)
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("update confluence page %q (id %s) to version %d", content.Title, content.Id, newContent.Version.Number), newContent.Body.Storage.Value)
+		return newContent, nil
+	}
 
-	_, err = conflunceClient.Do(req, nil)
-	perror(err)
+	return r.pages.UpdateContent(newContent)
 }
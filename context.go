@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The deadlines of the commands if --timeout is not set.
+const (
+	dailyTimeout        = 10 * time.Minute
+	weeklyReportTimeout = 30 * time.Minute
+	rotateSprintTimeout = 10 * time.Minute
+	triageTimeout       = 10 * time.Minute
+)
+
+// commandTimeout returns the --timeout flag, or the default deadline of
+// the command if it is not set.
+func commandTimeout(def time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return def
+}
+
+// newSignalContext returns a context cancelled on SIGINT or SIGTERM.
+func newSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case sig := <-sigs:
+			fmt.Printf("receive signal %s, stopping\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// requestContext is the context of the running command shared by the
+// services. go-jira and the Slack client don't take a context, so their
+// requests are bound to it by contextTransport.
+type requestContext struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func newRequestContext() *requestContext {
+	return &requestContext{ctx: context.Background()}
+}
+
+func (c *requestContext) get() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctx
+}
+
+func (c *requestContext) set(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+}
+
+// contextTransport sends the requests with the context of the command.
+type contextTransport struct {
+	ctx  *requestContext
+	base http.RoundTripper
+}
+
+func newContextTransport(ctx *requestContext, base http.RoundTripper) *contextTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &contextTransport{ctx: ctx, base: base}
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx.get()))
+}
+
+// sleepContext sleeps for the duration, and returns the error of the
+// context if it is done before that.
+func sleepContext(ctx context.Context, dur time.Duration) error {
+	timer := time.NewTimer(dur)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runWithTimeout runs f with the requests of the services bound to a
+// context derived from the parent, which is cancelled after the timeout.
+func (r *Reporter) runWithTimeout(parent context.Context, timeout time.Duration, f func() error) error {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	r.reqCtx.set(ctx)
+	defer r.reqCtx.set(context.Background())
+	return f()
+}
+
+// interrupted returns the error if the command is interrupted or timed out.
+func (r *Reporter) interrupted() error {
+	if err := r.reqCtx.get().Err(); err != nil {
+		return fmt.Errorf("interrupted: %v", err)
+	}
+	return nil
+}
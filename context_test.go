@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestRunWithTimeout(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	// The hung server replies nothing until the client gives up.
+	env.confluence.handle("GET", "/rest/api/content", func(r *http.Request, body string) interface{} {
+		<-r.Context().Done()
+		return nil
+	})
+
+	start := time.Now()
+	err := env.reporter.runWithTimeout(context.Background(), 50*time.Millisecond, func() error {
+		_, err := env.reporter.getContentByTitle("TT", "Weekly Reports")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("the request is not cancelled in time")
+	}
+	if err := env.reporter.reqCtx.get().Err(); err != nil {
+		t.Fatalf("expect the context reset after the command, got %v", err)
+	}
+}
+
+func TestRotateSprintInterrupted(t *testing.T) {
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	end := start.Add(week)
+	m := &memServices{
+		sprints: []jira.Sprint{
+			{ID: 1, Name: "TIKV 2018-09-28 - 2018-10-04", State: "active", StartDate: &start, EndDate: &end},
+		},
+		jiraIssues: []jira.Issue{{ID: "10001", Key: "TIKV-1"}},
+	}
+	r := newMemReporter(t, m)
+
+	// SIGINT arrives while the issues are moved.
+	ctx, cancel := context.WithCancel(context.Background())
+	m.afterCall = func(call string) {
+		if strings.HasPrefix(call, "MoveIssuesToSprint") {
+			cancel()
+		}
+	}
+	err := r.runWithTimeout(ctx, time.Minute, func() error { return r.rotateSprint(time.Now()) })
+	if err == nil {
+		t.Fatal("expect the rotation interrupted")
+	}
+	expect := "interrupted: context canceled, completed steps: created sprint TIKV 2018-10-05 - 2018-10-11, moved 1 issues to sprint TIKV 2018-10-05 - 2018-10-11"
+	if err.Error() != expect {
+		t.Fatalf("got %q, expect %q", err, expect)
+	}
+	if last := m.calls[len(m.calls)-1]; !strings.HasPrefix(last, "MoveIssuesToSprint") {
+		t.Errorf("expect no step after the interruption, last call is %q", last)
+	}
+}
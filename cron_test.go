@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	// 2018-10-04 is a Thursday.
+	base := time.Date(2018, 10, 4, 10, 30, 0, 0, loc)
+	tests := []struct {
+		expr   string
+		expect time.Time
+	}{
+		{"0 0 * * 5", time.Date(2018, 10, 5, 0, 0, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2018, 10, 4, 10, 45, 0, 0, loc)},
+		{"0 10 * * 1-5", time.Date(2018, 10, 5, 10, 0, 0, 0, loc)},
+		{"30 9,18 * * *", time.Date(2018, 10, 4, 18, 30, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2018, 11, 1, 0, 0, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2018, 10, 7, 0, 0, 0, 0, loc)},
+		// Either day-of-month or day-of-week matches.
+		{"0 0 31 * 6", time.Date(2018, 10, 6, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", tt.expr, err)
+		}
+		if got := c.next(base); !got.Equal(tt.expect) {
+			t.Errorf("%q: expect %s, got %s", tt.expr, tt.expect, got)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("expect error for %q", expr)
+		}
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	schedule, err := parseCron("0 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var runs []time.Time
+	s := &scheduler{
+		jobs: []*scheduledJob{{
+			name:     "daily",
+			schedule: schedule,
+			run: func(now time.Time) error {
+				runs = append(runs, now)
+				return nil
+			},
+		}},
+		loc:       time.UTC,
+		stateFile: filepath.Join(t.TempDir(), "state.json"),
+		lastRuns:  map[string]time.Time{},
+	}
+
+	// Never run before, wait for the next schedule.
+	now := time.Date(2018, 10, 4, 12, 0, 0, 0, time.UTC)
+	if next := s.runDue(now); !next.Equal(time.Date(2018, 10, 5, 10, 0, 0, 0, time.UTC)) || len(runs) != 0 {
+		t.Fatalf("unexpected next %s and runs %v", next, runs)
+	}
+
+	// Missed three days, run only once.
+	s.lastRuns["daily"] = time.Date(2018, 10, 1, 10, 0, 0, 0, time.UTC)
+	if next := s.runDue(now); !next.Equal(time.Date(2018, 10, 5, 10, 0, 0, 0, time.UTC)) || len(runs) != 1 {
+		t.Fatalf("unexpected next %s and runs %v", next, runs)
+	}
+
+	// A restart loads the saved state and doesn't run it again.
+	restarted := &scheduler{jobs: s.jobs, loc: s.loc, stateFile: s.stateFile, lastRuns: map[string]time.Time{}}
+	if err := restarted.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	restarted.runDue(now.Add(time.Minute))
+	if len(runs) != 1 {
+		t.Fatalf("expect no run after restart, got %v", runs)
+	}
+
+	restarted.runDue(time.Date(2018, 10, 5, 10, 0, 0, 0, time.UTC))
+	if len(runs) != 2 {
+		t.Fatalf("expect the scheduled run, got %v", runs)
+	}
+}
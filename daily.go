@@ -1,15 +1,15 @@
 package main
 
 import (
-	"bytes"
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
+	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
 )
 
-var regexRepo = regexp.MustCompile("github\\.com\\/([^\\/]+\\/[^\\/]+)\\/")
-
 func newDailyCommand() *cobra.Command {
 	m := &cobra.Command{
 		Use:   "daily",
@@ -22,37 +22,113 @@ func newDailyCommand() *cobra.Command {
 }
 
 func runDailyCommandFunc(cmd *cobra.Command, args []string) {
-	now := time.Now().UTC()
-	start := now.Add(-24 * time.Hour).Format(githubUTCDateFormat)
-
-	var buf bytes.Buffer
-	buf.WriteString("*Daily Report*\n\n")
-
-	issues := getCreatedIssues(&start, nil)
-	formatSectionForSlackOutput(&buf, "New Issues", "New issues in last 24 hours")
-	formatGitHubIssuesForSlackOutput(&buf, issues)
-	buf.WriteString("\n")
-
-	issues = getCreatedPullRequests(&start, nil)
-	formatSectionForSlackOutput(&buf, "New Pull Requests", "New PRs in last 24 hours")
-	formatGitHubIssuesForSlackOutput(&buf, issues)
-	buf.WriteString("\n")
-
-	// last3Days := now.Add(-3 * 24 * time.Hour).Format(githubUTCDateFormat)
-	// issues = getInactiveCommunityPullRequests(nil, &last3Days)
-	// formatSectionForSlackOutput(&buf, "Inactive Community Pull Requests", "Community PRs inactive >= 3 days")
-	// formatGitHubIssuesForSlackOutput(&buf, issues)
-	// buf.WriteString("\n")
-
-	oncallIssues := queryJiraIssues("project = ONCALL AND created >= \"-1d\"")
-	formatSectionForSlackOutput(&buf, "New OnCalls", "New on calls in last 24 hours")
-	formatJiraIssuesForSlackOutput(&buf, oncallIssues)
-	buf.WriteString("\n")
-
-	oncallIssues = queryJiraIssues("project = ONCALL AND priority = Highest AND resolution = Unresolved AND updated <= \"-3d\"")
-	formatSectionForSlackOutput(&buf, "Inactive OnCalls", "Highest priority on calls inactive >= 3 days")
-	formatJiraIssuesForSlackOutput(&buf, oncallIssues)
-	buf.WriteString("\n")
-
-	sendToSlack(buf.String())
+	runCommand(dailyTimeout, func(r *Reporter) error { return r.runDailyReport(time.Now().UTC()) })
+}
+
+// runDailyReport sends one daily report to each team if any team has its own
+// Slack channel, the teams without one get theirs in the global channel.
+// Otherwise one report is sent to the global channel.
+func (r *Reporter) runDailyReport(now time.Time) error {
+	var errs reportErrors
+	perTeam := false
+	for _, team := range r.config.Teams {
+		if len(team.Channel) > 0 {
+			perTeam = true
+		}
+	}
+
+	if !perTeam {
+		r.runScopedDailyReport("Daily Report", "", now, &errs)
+		return errs.toError()
+	}
+	for _, team := range r.config.Teams {
+		r.forTeam(team).runScopedDailyReport(fmt.Sprintf("Daily Report - %s", team.Name), team.Name+" ", now, &errs)
+	}
+	return errs.toError()
+}
+
+// runScopedDailyReport sends the daily report of the Reporter's scope, the
+// failures are collected with the source prefix.
+func (r *Reporter) runScopedDailyReport(title string, prefix string, now time.Time, errs *reportErrors) {
+	// The duty sections are fetched with the configured ones, and go first.
+	var dutySections []slackSection
+	dailySections := make([]slackSection, len(r.config.Daily.Sections))
+	r.runParallel(len(dailySections)+1, func(i int) {
+		if i == 0 {
+			dutySections = r.genDutySections(now)
+		} else {
+			dailySections[i-1] = r.genDailySection(r.config.Daily.Sections[i-1], now)
+		}
+	})
+
+	sections := append(dutySections, dailySections...)
+	for _, s := range sections {
+		errs.add(prefix+s.Title, s.Err)
+	}
+
+	errs.add(prefix+"Slack", r.sendReportToSlack(title, sections))
+}
+
+func (r *Reporter) genDailySection(section DailySection, now time.Time) slackSection {
+	s := slackSection{Title: section.Title, Description: section.Description}
+	if jql := r.getDailySectionJQL(section); len(jql) > 0 {
+		issues, err := r.queryJiraIssues(jql)
+		for _, issue := range issues {
+			s.Items = append(s.Items, r.formatJiraIssueForSlackOutput(issue))
+		}
+		s.Err = err
+	} else {
+		issues, err := r.getDailySectionIssues(section, now)
+		for _, issue := range issues {
+			s.Items = append(s.Items, r.formatGitHubIssueForSlackOutput(issue))
+		}
+		s.Err = err
+	}
+	return s
+}
+
+func (r *Reporter) getDailySectionJQL(section DailySection) string {
+	switch section.OnCall {
+	case dailyOnCallNew:
+		return r.config.Jira.newOnCallJQL("-1d", "")
+	case dailyOnCallInactive:
+		return r.config.Jira.inactiveOnCallJQL()
+	}
+	return strings.ReplaceAll(section.JQL, "{project}", r.config.Jira.Project)
+}
+
+func (r *Reporter) getDailySectionIssues(section DailySection, now time.Time) ([]github.Issue, error) {
+	queryArgs := make(map[string]string, len(section.Github))
+	for key, value := range section.Github {
+		v, err := resolveRelativeDateQuery(value, now)
+		if err != nil {
+			return nil, err
+		}
+		queryArgs[key] = v
+	}
+
+	issues, err := r.getIssues(section.Sort, queryArgs)
+	if err != nil {
+		return nil, err
+	}
+	if section.Community {
+		return r.filterCommunityIssues(issues), nil
+	}
+	return issues, nil
+}
+
+var regexRelativeDate = regexp.MustCompile(`^(>=|<=|>|<)-(\w+)$`)
+
+// Converts a relative date qualifier like ">=-24h" to an absolute one
+// like ">=2018-10-04T00:00:00Z". Other values are returned as they are.
+func resolveRelativeDateQuery(value string, now time.Time) (string, error) {
+	matches := regexRelativeDate.FindStringSubmatch(value)
+	if matches == nil {
+		return value, nil
+	}
+	dur, err := time.ParseDuration(matches[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid relative date %q: %v", value, err)
+	}
+	return matches[1] + now.Add(-dur).UTC().Format(githubUTCDateFormat), nil
 }
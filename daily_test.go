@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveRelativeDateQuery(t *testing.T) {
+	now := time.Date(2018, 10, 5, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		expect string
+	}{
+		{">=-24h", ">=2018-10-04T08:00:00Z"},
+		{"<-72h", "<2018-10-02T08:00:00Z"},
+		{"open", "open"},
+		{"2018-10-01..2018-10-05", "2018-10-01..2018-10-05"},
+	}
+	for _, tt := range tests {
+		got, err := resolveRelativeDateQuery(tt.value, now)
+		if err != nil {
+			t.Fatalf("resolve %q failed: %v", tt.value, err)
+		}
+		if got != tt.expect {
+			t.Errorf("resolve %q: expect %q, got %q", tt.value, tt.expect, got)
+		}
+	}
+
+	if _, err := resolveRelativeDateQuery(">=-1d", now); err == nil {
+		t.Error("expect error for invalid duration")
+	}
+}
+
+func TestOnCallJQL(t *testing.T) {
+	j := Jira{OnCall: "OC", OnCallPriority: "High", OnCallInactiveDays: 5}
+	tests := []struct {
+		jql    string
+		expect string
+	}{
+		{j.newOnCallJQL("-1d", ""), `project = OC AND created >= "-1d"`},
+		{j.newOnCallJQL("2018-10-05", "2018-10-12"), `project = OC AND created >= "2018-10-05" AND created < "2018-10-12"`},
+		{j.urgentOnCallJQL(), `project = OC AND priority >= "High" AND resolution = Unresolved`},
+		{j.inactiveOnCallJQL(), `project = OC AND priority >= "High" AND resolution = Unresolved AND updated <= "-5d"`},
+	}
+	for _, tt := range tests {
+		if tt.jql != tt.expect {
+			t.Errorf("expect %s, got %s", tt.expect, tt.jql)
+		}
+	}
+}
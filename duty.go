@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// dutyStart returns the start of the first duty, at 00:00 in the sprint
+// timezone, or in UTC if it is not configured.
+func (c *Config) dutyStart() (time.Time, error) {
+	loc := c.Sprint.location()
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.ParseInLocation(dayFormat, c.Duty.Start, loc)
+}
+
+// getDutyMembers returns the duty rosters of the sprint at now.
+func (r *Reporter) getDutyMembers(now time.Time) []string {
+	duty := r.config.Duty
+	if len(duty.Members) == 0 {
+		return nil
+	}
+
+	// The start is validated in Config.adjust.
+	start, err := r.config.dutyStart()
+	if err != nil {
+		return nil
+	}
+	elapsed := now.Sub(start)
+	length := r.config.Sprint.duration()
+	sprints := int(elapsed / length)
+	if elapsed%length < 0 {
+		sprints--
+	}
+
+	n := len(duty.Members)
+	offset := (sprints*duty.Size%n + n) % n
+	members := make([]string, 0, duty.Size)
+	for i := 0; i < duty.Size; i++ {
+		members = append(members, duty.Members[(offset+i)%n])
+	}
+	return members
+}
+
+// findMember returns the team member with the GitHub login.
+func (r *Reporter) findMember(login string) (Member, bool) {
+	for _, team := range r.config.Teams {
+		for _, member := range team.Members {
+			if strings.EqualFold(member.Github, login) {
+				return member, true
+			}
+		}
+	}
+	return Member{}, false
+}
+
+// buildDutyMentions mentions the duty rosters in Slack, or by the GitHub
+// login if the email is unknown.
+func (r *Reporter) buildDutyMentions(members []string) string {
+	mentions := make([]string, 0, len(members))
+	for _, login := range members {
+		if m, ok := r.findMember(login); ok && len(m.Email) > 0 {
+			mentions = append(mentions, r.buildSlackMention(m.Email))
+		} else {
+			mentions = append(mentions, "@"+login)
+		}
+	}
+	return strings.Join(mentions, " ")
+}
+
+// genDutySections generates the sections listing the duty rosters and the
+// new issues and PRs nobody is assigned to, or nothing if no roster is
+// configured.
+func (r *Reporter) genDutySections(now time.Time) []slackSection {
+	members := r.getDutyMembers(now)
+	if len(members) == 0 {
+		return nil
+	}
+	mentions := r.buildDutyMentions(members)
+
+	duty := slackSection{
+		Title:       "Duty",
+		Description: "The duty rosters of this sprint",
+		Items:       []string{mentions},
+	}
+
+	triage := slackSection{
+		Title:       "Needs Triage",
+		Description: "New issues and PRs in last 24 hours not assigned to anyone",
+	}
+	start := now.Add(-24 * time.Hour).UTC().Format(githubUTCDateFormat)
+	for _, get := range []func(start *string, end *string) ([]github.Issue, error){
+		r.getCreatedIssues,
+		r.getCreatedPullRequests,
+	} {
+		issues, err := get(&start, nil)
+		if err != nil {
+			triage.Err = err
+			break
+		}
+		for _, issue := range issues {
+			if len(issue.Assignees) == 0 {
+				triage.Items = append(triage.Items,
+					fmt.Sprintf("%s needs triage by %s", r.formatGitHubIssueForSlackOutput(issue), mentions))
+			}
+		}
+	}
+	if triage.Err != nil {
+		triage.Items = nil
+	}
+	return []slackSection{duty, triage}
+}
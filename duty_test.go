@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestGetDutyMembers(t *testing.T) {
+	r := newMemReporter(t, &memServices{})
+	r.config.Duty = Duty{Members: []string{"a", "b", "c"}, Size: 2, Start: "2018-09-28"}
+
+	tbl := []struct {
+		now    string
+		expect []string
+	}{
+		{"2018-09-28T00:00:00Z", []string{"a", "b"}},
+		{"2018-10-04T23:59:59Z", []string{"a", "b"}},
+		{"2018-10-05T00:00:00Z", []string{"c", "a"}},
+		{"2018-10-12T00:00:00Z", []string{"b", "c"}},
+		{"2018-10-19T00:00:00Z", []string{"a", "b"}},
+		{"2018-09-27T00:00:00Z", []string{"b", "c"}},
+		{"2018-09-21T00:00:00Z", []string{"b", "c"}},
+	}
+	for _, tt := range tbl {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		if got := r.getDutyMembers(now); !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("at %s expect %v, got %v", tt.now, tt.expect, got)
+		}
+	}
+}
+
+func TestGetDutyMembersInSprintTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Shanghai"); err != nil {
+		t.Skip(err)
+	}
+	r := newMemReporter(t, &memServices{})
+	r.config.Sprint.Timezone = "Asia/Shanghai"
+	r.config.Duty = Duty{Members: []string{"a", "b", "c"}, Size: 2, Start: "2018-09-28"}
+
+	// The sprint starts at 2018-10-05 00:00 in Shanghai.
+	tbl := []struct {
+		now    string
+		expect []string
+	}{
+		{"2018-10-04T15:59:59Z", []string{"a", "b"}},
+		{"2018-10-04T16:00:00Z", []string{"c", "a"}},
+	}
+	for _, tt := range tbl {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		if got := r.getDutyMembers(now); !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("at %s expect %v, got %v", tt.now, tt.expect, got)
+		}
+	}
+}
+
+func TestDutyStartValidation(t *testing.T) {
+	tbl := []struct {
+		start   string
+		weekday string
+		err     string
+	}{
+		{"2018/09/28", "", "invalid duty start"},
+		{"2018-09-27", "Friday", "must be a Friday"},
+		{"2018-09-28", "Friday", ""},
+	}
+	for _, tt := range tbl {
+		cfg := Config{
+			Duty:   Duty{Members: []string{"a"}, Start: tt.start},
+			Sprint: Sprint{Weekday: tt.weekday},
+		}
+		err := cfg.adjust()
+		if len(tt.err) == 0 && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.start, err)
+		} else if len(tt.err) > 0 && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expect error %q, got %v", tt.start, tt.err, err)
+		}
+	}
+}
+
+func TestGenDutySections(t *testing.T) {
+	m := &memServices{
+		githubIssues: []github.Issue{
+			{
+				HTMLURL: github.String("https://github.com/tikv/tikv/issues/1"),
+				Title:   github.String("Unassigned"),
+				User:    &github.User{Login: github.String("alice")},
+			},
+			{
+				HTMLURL:   github.String("https://github.com/tikv/tikv/issues/2"),
+				Title:     github.String("Assigned"),
+				User:      &github.User{Login: github.String("alice")},
+				Assignees: []*github.User{{Login: github.String("bob")}},
+			},
+		},
+		userIDs: map[string]string{"tl@pingcap.com": "U1"},
+	}
+	r := newMemReporter(t, m)
+	r.config.Teams = []Team{{Name: "Team", Members: []Member{{Github: "siddontang", Email: "tl@pingcap.com"}}}}
+	r.config.Duty = Duty{Members: []string{"siddontang", "bob"}, Size: 2, Start: "2018-09-28"}
+
+	sections := r.genDutySections(time.Date(2018, 10, 5, 8, 0, 0, 0, time.UTC))
+	if len(sections) != 2 {
+		t.Fatalf("expect duty and triage sections, got %v", sections)
+	}
+	if !reflect.DeepEqual(sections[0].Items, []string{"<@U1> @bob"}) {
+		t.Errorf("unexpected duty %q", sections[0].Items)
+	}
+	// Both the issue and the PR search return the same fake issues.
+	triage := sections[1].Items
+	if len(triage) != 2 || !strings.HasSuffix(triage[0], "|Unassigned> by @alice needs triage by <@U1> @bob") {
+		t.Errorf("unexpected triage %q", triage)
+	}
+}
+
+func TestGenDutySectionsWithoutRoster(t *testing.T) {
+	r := newMemReporter(t, &memServices{})
+	if sections := r.genDutySections(time.Now()); sections != nil {
+		t.Errorf("expect no duty sections, got %v", sections)
+	}
+}
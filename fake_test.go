@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedRequest is a request received by the fake server.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// fakeFailure makes the fake server reply with the status code.
+type fakeFailure struct {
+	Status  int
+	Message string
+}
+
+// fakeServer is an in-process server standing in for GitHub, Jira,
+// Confluence or Slack. It records every request and replies with the
+// JSON returned by the handler registered for the method and path.
+type fakeServer struct {
+	*httptest.Server
+
+	t        *testing.T
+	mu       sync.Mutex
+	requests []recordedRequest
+	handlers map[string]func(r *http.Request, body string) interface{}
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{
+		t:        t,
+		handlers: make(map[string]func(r *http.Request, body string) interface{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// handle registers the handler for the method and path, the path
+// ends with "*" to match all the paths with the prefix.
+func (s *fakeServer) handle(method string, path string, h func(r *http.Request, body string) interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method+" "+path] = h
+}
+
+// reply registers a handler always replying the value.
+func (s *fakeServer) reply(method string, path string, v interface{}) {
+	s.handle(method, path, func(*http.Request, string) interface{} { return v })
+}
+
+func (s *fakeServer) lookup(method string, path string) func(r *http.Request, body string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.handlers[method+" "+path]; ok {
+		return h
+	}
+	for key, h := range s.handlers {
+		if strings.HasSuffix(key, "*") && strings.HasPrefix(method+" "+path, strings.TrimSuffix(key, "*")) {
+			return h
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	body := string(data)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, recordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Body:   body,
+	})
+	s.mu.Unlock()
+
+	h := s.lookup(r.Method, r.URL.Path)
+	if h == nil {
+		s.t.Errorf("unexpected request %s %s?%s", r.Method, r.URL.Path, r.URL.RawQuery)
+		http.NotFound(w, r)
+		return
+	}
+
+	v := h(r, body)
+	if f, ok := v.(fakeFailure); ok {
+		http.Error(w, f.Message, f.Status)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// requestsTo returns the recorded requests with the method and path.
+func (s *fakeServer) requestsTo(method string, path string) []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reqs []recordedRequest
+	for _, req := range s.requests {
+		if req.Method == method && req.Path == path {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+// fakeEnv wires a Reporter to the fake servers.
+type fakeEnv struct {
+	github     *fakeServer
+	jira       *fakeServer
+	confluence *fakeServer
+	slack      *fakeServer
+
+	reporter *Reporter
+}
+
+func newFakeEnv(t *testing.T) *fakeEnv {
+	env := &fakeEnv{
+		github:     newFakeServer(t),
+		jira:       newFakeServer(t),
+		confluence: newFakeServer(t),
+		slack:      newFakeServer(t),
+	}
+
+	cfg := &Config{
+		Slack: Slack{
+			Token:    "slack-token",
+			Channel:  "team",
+			User:     "reporter",
+			Endpoint: env.slack.URL + "/api/",
+		},
+		Jira: Jira{
+			User:     "user",
+			Password: "password",
+			Endpoint: env.jira.URL + "/",
+			ServerID: "server-id",
+			Server:   "JIRA",
+			Project:  "TIKV",
+			OnCall:   "OC",
+		},
+		Confluence: Confluence{
+			Endpoint:   env.confluence.URL + "/",
+			Space:      "TT",
+			WeeklyPath: "Weekly Reports",
+		},
+		Github: Github{
+			Token:    "github-token",
+			Repos:    []string{"tikv/tikv"},
+			Endpoint: env.github.URL + "/",
+		},
+		Teams: []Team{
+			{
+				Name: "Team",
+				Members: []Member{
+					{Name: "Siddon Tang", Github: "siddontang", Email: "tl@pingcap.com"},
+				},
+			},
+		},
+		// Fetch one by one so the requests are recorded in order.
+		Concurrency: 1,
+	}
+	if err := cfg.adjust(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReporter(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.reporter = r
+
+	env.slack.reply("POST", "/api/users.list", map[string]interface{}{
+		"ok": true,
+		"members": []interface{}{
+			map[string]interface{}{"id": "U1", "profile": map[string]string{"email": "tl@pingcap.com"}},
+		},
+	})
+	env.slack.reply("POST", "/api/chat.postMessage", map[string]interface{}{
+		"ok": true, "channel": "C1", "ts": "1",
+	})
+	return env
+}
+
+func (env *fakeEnv) close() {
+	env.github.Close()
+	env.jira.Close()
+	env.confluence.Close()
+	env.slack.Close()
+}
+
+// slackMessages returns the texts posted to Slack.
+func (env *fakeEnv) slackMessages() []string {
+	var msgs []string
+	for _, req := range env.slack.requestsTo("POST", "/api/chat.postMessage") {
+		form := parseForm(env.slack.t, req.Body)
+		msgs = append(msgs, form.Get("text"))
+	}
+	return msgs
+}
+
+func parseForm(t *testing.T, body string) url.Values {
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		t.Fatalf("invalid form %q: %v", body, err)
+	}
+	return form
+}
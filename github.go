@@ -3,22 +3,52 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
 )
 
-var repoQuery string
-
-var allMembers []string
-
 const (
 	// go-github/github incorrectly handles URL escape with "+", so we avoid "+" by using a UTC time
 	githubUTCDateFormat = "2006-01-02T15:04:05Z"
 )
 
+var (
+	// The API URL of the repository, like https://api.github.com/repos/tikv/tikv
+	// or https://github.example.com/api/v3/repos/tikv/tikv on GitHub Enterprise.
+	regexRepositoryURL = regexp.MustCompile(`/repos/([^/]+/[^/]+)/?$`)
+	// The HTML URL of the issue or PR on any host.
+	regexIssueHTMLURL = regexp.MustCompile(`^https?://[^/]+/([^/]+/[^/]+)/(?:issues|pull)/\d+`)
+)
+
+// issueRepo returns the owner/repo of the issue or PR.
+func issueRepo(issue github.Issue) (string, error) {
+	if m := regexRepositoryURL.FindStringSubmatch(issue.GetRepositoryURL()); m != nil {
+		return m[1], nil
+	}
+	if m := regexIssueHTMLURL.FindStringSubmatch(issue.GetHTMLURL()); m != nil {
+		return m[1], nil
+	}
+	return "", fmt.Errorf("unknown repository of %s", issue.GetHTMLURL())
+}
+
+// issueRepoName returns the owner/repo of the issue or PR to show in the
+// reports, which still list the issue if it is unknown.
+func issueRepoName(issue github.Issue) string {
+	repo, err := issueRepo(issue)
+	if err != nil {
+		return "unknown"
+	}
+	return repo
+}
+
 // IssueSlice is the slice of issues
 type IssueSlice []github.Issue
 
@@ -28,22 +58,69 @@ func (s IssueSlice) Less(i, j int) bool {
 	return s[i].GetHTMLURL() < s[j].GetHTMLURL()
 }
 
-func getIssues(bySort string, queryArgs map[string]string) IssueSlice {
-	opt := github.SearchOptions{
-		Sort: bySort,
-	}
+// githubIssueSource is the IssueSource backed by the GitHub search API.
+type githubIssueSource struct {
+	ctx    *requestContext
+	client *github.Client
 
-	var allIssues IssueSlice
+	mu sync.Mutex
+	// The searches wait until the rate limit is reset once any of them
+	// meets it, so the parallel ones don't keep hitting the limit.
+	resumeAt time.Time
+}
 
-	query := bytes.NewBufferString(repoQuery)
+// newGithubIssueSource creates the source sending the requests with the
+// context through the transport, or the default one if it is nil.
+func newGithubIssueSource(cfg Github, ctx *requestContext, transport http.RoundTripper) (*githubIssueSource, error) {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: cfg.Token},
+	)
 
-	for key, value := range queryArgs {
-		query.WriteString(fmt.Sprintf(" %s:%s", key, value))
+	tc := &http.Client{Transport: &oauth2.Transport{Source: ts, Base: transport}}
+	client := github.NewClient(tc)
+	if len(cfg.Endpoint) > 0 {
+		// Use GitHub Enterprise or a fake server in tests.
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		client.BaseURL = endpoint
+	}
+	return &githubIssueSource{ctx: ctx, client: client}, nil
+}
+
+func (s *githubIssueSource) SearchIssues(query string, bySort string) ([]github.Issue, bool, error) {
+	issues, truncated, incomplete, err := s.search(query, bySort)
+	if err != nil || truncated || !incomplete {
+		return issues, truncated, err
+	}
+	// The search timed out on GitHub, retry once and use the partial
+	// results if it times out again.
+	issues, truncated, incomplete, err = s.search(query, bySort)
+	if incomplete && err == nil && !truncated {
+		fmt.Printf("search %q timed out, the results may be incomplete\n", query)
+	}
+	return issues, truncated, err
+}
+
+// search returns the issues matching the query, whether there are more than
+// githubSearchLimit results and the pages are not loaded, and whether the
+// search timed out on GitHub.
+func (s *githubIssueSource) search(query string, bySort string) ([]github.Issue, bool, bool, error) {
+	opt := github.SearchOptions{
+		Sort:        bySort,
+		ListOptions: github.ListOptions{PerPage: 100},
 	}
 
+	var allIssues []github.Issue
+	incomplete := false
+
 	retryCount := 0
 	for {
-		issues, resp, err := githubClient.Search.Issues(globalCtx, query.String(), &opt)
+		if err := s.waitRateLimit(); err != nil {
+			return nil, false, false, err
+		}
+		issues, resp, err := s.client.Search.Issues(s.ctx.get(), query, &opt)
 		if err1, ok := err.(*github.RateLimitError); ok {
 			dur := err1.Rate.Reset.Time.Sub(time.Now())
 			if dur < 0 {
@@ -52,13 +129,34 @@ func getIssues(bySort string, queryArgs map[string]string) IssueSlice {
 			retryCount++
 			if retryCount <= 10 {
 				fmt.Printf("meet RateLimitError, wait %s and retry %d\n", dur, retryCount)
-				time.Sleep(dur)
+				s.pauseFor(dur)
+				continue
+			}
+		}
+		if err1, ok := err.(*github.AbuseRateLimitError); ok {
+			// The secondary rate limit is met by the concurrent requests.
+			dur := err1.GetRetryAfter()
+			if dur <= 0 {
+				dur = time.Minute
+			}
+			retryCount++
+			if retryCount <= 10 {
+				fmt.Printf("meet AbuseRateLimitError, wait %s and retry %d\n", dur, retryCount)
+				s.pauseFor(dur)
 				continue
 			}
 		}
 
-		perror(err)
+		if err != nil {
+			return nil, false, false, err
+		}
 
+		// GitHub returns at most 1000 results of a search, don't load the
+		// pages if the results will be truncated.
+		if issues.GetTotal() > githubSearchLimit {
+			return allIssues, true, false, nil
+		}
+		incomplete = incomplete || issues.GetIncompleteResults()
 		allIssues = append(allIssues, issues.Issues...)
 
 		if resp.NextPage == 0 {
@@ -67,8 +165,111 @@ func getIssues(bySort string, queryArgs map[string]string) IssueSlice {
 		opt.ListOptions.Page = resp.NextPage
 	}
 
+	return allIssues, false, incomplete, nil
+}
+
+// waitRateLimit waits until the rate limit met by any search is reset, or
+// the command is interrupted.
+func (s *githubIssueSource) waitRateLimit() error {
+	s.mu.Lock()
+	dur := time.Until(s.resumeAt)
+	s.mu.Unlock()
+	if dur > 0 {
+		return sleepContext(s.ctx.get(), dur)
+	}
+	return nil
+}
+
+// pauseFor pauses all the searches for the duration.
+func (s *githubIssueSource) pauseFor(dur time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if resumeAt := time.Now().Add(dur); resumeAt.After(s.resumeAt) {
+		s.resumeAt = resumeAt
+	}
+}
+
+func splitRepo(repo string) (string, string, error) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid repo %q, must be owner/name", repo)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (s *githubIssueSource) AddAssignees(repo string, number int, assignees []string) error {
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return err
+	}
+	_, _, err = s.client.Issues.AddAssignees(s.ctx.get(), owner, name, number, assignees)
+	return err
+}
+
+func (s *githubIssueSource) ListPullRequestFiles(repo string, number int) ([]string, error) {
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		files, resp, err := s.client.PullRequests.ListFiles(s.ctx.get(), owner, name, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			paths = append(paths, file.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return paths, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (s *githubIssueSource) ListReviews(repo string, number int) ([]github.PullRequestReview, error) {
+	owner, name, err := splitRepo(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var reviews []github.PullRequestReview
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := s.client.PullRequests.ListReviews(s.ctx.get(), owner, name, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, review := range page {
+			reviews = append(reviews, *review)
+		}
+		if resp.NextPage == 0 {
+			return reviews, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (r *Reporter) getIssues(bySort string, queryArgs map[string]string) (IssueSlice, error) {
+	issues, err := r.searchAllIssues(bySort, queryArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	allIssues := IssueSlice(issues)
 	sort.Sort(allIssues)
-	return allIssues
+	return allIssues, nil
+}
+
+func (r *Reporter) buildSearchQuery(queryArgs map[string]string) string {
+	query := bytes.NewBufferString(r.repoQuery)
+
+	for key, value := range queryArgs {
+		query.WriteString(fmt.Sprintf(" %s:%s", key, value))
+	}
+	return query.String()
 }
 
 func generateDateRangeQuery(start *string, end *string) string {
@@ -83,66 +284,149 @@ func generateDateRangeQuery(start *string, end *string) string {
 	}
 }
 
-func getCreatedIssues(start *string, end *string) []github.Issue {
-	return getIssues("created", map[string]string{
+func (r *Reporter) getCreatedIssues(start *string, end *string) ([]github.Issue, error) {
+	return r.getIssues("created", map[string]string{
 		"is":      "issue",
 		"created": generateDateRangeQuery(start, end),
 	})
 }
 
-func getCreatedPullRequests(start *string, end *string) []github.Issue {
-	return getIssues("created", map[string]string{
+func (r *Reporter) getCreatedPullRequests(start *string, end *string) ([]github.Issue, error) {
+	return r.getIssues("created", map[string]string{
 		"is":      "pr",
 		"created": generateDateRangeQuery(start, end),
 	})
 }
 
-func getMergedPullRequests(start *string, end *string) []github.Issue {
-	return getIssues("created", map[string]string{
+func (r *Reporter) getMergedPullRequests(start *string, end *string) ([]github.Issue, error) {
+	return r.getIssues("created", map[string]string{
 		"is":     "merged",
 		"merged": generateDateRangeQuery(start, end),
 	})
 }
 
-func getReviewPullRequests(user string, start *string, end *string) []github.Issue {
-	return getIssues("updated", map[string]string{
-		"is":        "pr",
-		"commenter": user,
-		"-author":   user,
-		"updated":   generateDateRangeQuery(start, end),
+// Returns the PRs authored by the user and merged in the range.
+func (r *Reporter) getAuthoredPullRequests(user string, start *string, end *string) ([]github.Issue, error) {
+	return r.getIssues("created", map[string]string{
+		"is":     "merged",
+		"author": user,
+		"merged": generateDateRangeQuery(start, end),
 	})
 }
 
-func getInactiveCommunityPullRequests(start *string, end *string) []github.Issue {
-	openPullRequests := getIssues("updated", map[string]string{
-		"is":      "pr",
-		"state":   "open",
-		"updated": generateDateRangeQuery(start, end),
-	})
+// reviewedPullRequest is a PR with the reviews submitted by one user.
+type reviewedPullRequest struct {
+	issue            github.Issue
+	approved         int
+	changesRequested int
+	commented        int
+}
 
-	communityPullRequests := make([]github.Issue, 0, len(openPullRequests))
-nextOpenIssue:
-	for _, issue := range openPullRequests {
-		login := issue.GetUser().GetLogin()
-		for _, id := range allMembers {
-			if strings.EqualFold(id, login) {
-				continue nextOpenIssue
+// Returns the PRs the user submitted reviews to in the range, with the
+// counts of the reviews. The author's own PRs are excluded.
+func (r *Reporter) getReviewPullRequests(user string, start *string, end *string) ([]reviewedPullRequest, error) {
+	// A PR reviewed in the range must be updated after the start, the end
+	// is not used to filter because the PR may be updated again later.
+	query := map[string]string{
+		"is":          "pr",
+		"reviewed-by": user,
+		"-author":     user,
+	}
+	if start != nil {
+		query["updated"] = generateDateRangeQuery(start, nil)
+	}
+	issues, err := r.getIssues("updated", query)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := func(t time.Time) bool {
+		if start != nil {
+			if s, err := time.Parse(githubUTCDateFormat, *start); err == nil && t.Before(s) {
+				return false
+			}
+		}
+		if end != nil {
+			if e, err := time.Parse(githubUTCDateFormat, *end); err == nil && !t.Before(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var prs []reviewedPullRequest
+	for _, issue := range issues {
+		repo, err := issueRepo(issue)
+		if err != nil {
+			return nil, err
+		}
+		reviews, err := r.issues.ListReviews(repo, issue.GetNumber())
+		if err != nil {
+			return nil, err
+		}
+
+		pr := reviewedPullRequest{issue: issue}
+		for _, review := range reviews {
+			if !strings.EqualFold(review.GetUser().GetLogin(), user) || !inRange(review.GetSubmittedAt()) {
+				continue
+			}
+			switch review.GetState() {
+			case "APPROVED":
+				pr.approved++
+			case "CHANGES_REQUESTED":
+				pr.changesRequested++
+			case "COMMENTED":
+				pr.commented++
 			}
 		}
-		communityPullRequests = append(communityPullRequests, issue)
+		if pr.approved+pr.changesRequested+pr.commented > 0 {
+			prs = append(prs, pr)
+		}
 	}
-	return communityPullRequests
+	return prs, nil
 }
 
-func initRepoQuery() {
-	s := strings.Join(config.Github.Repos, " repo:")
-	repoQuery = "repo:" + s
+// Returns the open issues and PRs nobody is assigned to.
+func (r *Reporter) getUnassignedIssues(start *string, end *string) ([]github.Issue, error) {
+	return r.getIssues("created", map[string]string{
+		"state":   "open",
+		"no":      "assignee",
+		"created": generateDateRangeQuery(start, end),
+	})
+}
+
+// addAssignees assigns the issue to the users.
+func (r *Reporter) addAssignees(issue github.Issue, assignees []string) error {
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("assign %s to %s", issue.GetHTMLURL(), strings.Join(assignees, ", ")), "")
+		return nil
+	}
+	repo, err := issueRepo(issue)
+	if err != nil {
+		return err
+	}
+	return r.issues.AddAssignees(repo, issue.GetNumber(), assignees)
+}
+
+func (r *Reporter) getInactiveCommunityPullRequests(start *string, end *string) ([]github.Issue, error) {
+	openPullRequests, err := r.getIssues("updated", map[string]string{
+		"is":      "pr",
+		"state":   "open",
+		"updated": generateDateRangeQuery(start, end),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.filterCommunityIssues(openPullRequests), nil
 }
 
-func initTeamMembers() {
-	for _, team := range config.Teams {
-		for _, member := range team.Members {
-			allMembers = append(allMembers, member.Github)
+// Returns the issues which are not created by the team members.
+func (r *Reporter) filterCommunityIssues(issues []github.Issue) []github.Issue {
+	communityIssues := make([]github.Issue, 0, len(issues))
+	for _, issue := range issues {
+		if !r.isTeamMember(issue.GetUser().GetLogin()) {
+			communityIssues = append(communityIssues, issue)
 		}
 	}
+	return communityIssues
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// GitHub returns at most 1000 results for a search.
+const githubSearchLimit = 1000
+
+// The qualifiers of the date range a search can be split by.
+var githubDateQualifiers = []string{"created", "merged", "closed", "updated"}
+
+// The date GitHub launched, used as the start of a range without one.
+var githubEpoch = time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// dateRange is an inclusive range of the search, start or end is nil if
+// the range is open.
+type dateRange struct {
+	start *time.Time
+	end   *time.Time
+}
+
+func parseGithubDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(githubUTCDateFormat, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(dayFormat, value)
+	return t, true, err
+}
+
+// parseDateRangeQuery parses the date range generated by generateDateRangeQuery,
+// a date without the time covers the whole day.
+func parseDateRangeQuery(value string) (dateRange, error) {
+	parseStart := func(s string, inclusive bool) (*time.Time, error) {
+		t, isDay, err := parseGithubDate(s)
+		if isDay && !inclusive {
+			t = t.Add(24 * time.Hour)
+		} else if !inclusive {
+			t = t.Add(time.Second)
+		}
+		return &t, err
+	}
+	parseEnd := func(s string, inclusive bool) (*time.Time, error) {
+		t, isDay, err := parseGithubDate(s)
+		if isDay && inclusive {
+			t = t.Add(24*time.Hour - time.Second)
+		} else if !inclusive {
+			t = t.Add(-time.Second)
+		}
+		return &t, err
+	}
+
+	var (
+		r   dateRange
+		err error
+	)
+	switch {
+	case strings.Contains(value, ".."):
+		parts := strings.SplitN(value, "..", 2)
+		if r.start, err = parseStart(parts[0], true); err == nil {
+			r.end, err = parseEnd(parts[1], true)
+		}
+	case strings.HasPrefix(value, ">="):
+		r.start, err = parseStart(value[2:], true)
+	case strings.HasPrefix(value, ">"):
+		r.start, err = parseStart(value[1:], false)
+	case strings.HasPrefix(value, "<="):
+		r.end, err = parseEnd(value[2:], true)
+	case strings.HasPrefix(value, "<"):
+		r.end, err = parseEnd(value[1:], false)
+	default:
+		err = fmt.Errorf("unsupported date range %q", value)
+	}
+	return r, err
+}
+
+func (r dateRange) query() string {
+	var start *string
+	if r.start != nil {
+		s := r.start.UTC().Format(githubUTCDateFormat)
+		start = &s
+	}
+	if r.end == nil {
+		return generateDateRangeQuery(start, nil)
+	}
+	if start == nil {
+		// The end of generateDateRangeQuery is exclusive without the start.
+		e := r.end.Add(time.Second).UTC().Format(githubUTCDateFormat)
+		return generateDateRangeQuery(nil, &e)
+	}
+	e := r.end.UTC().Format(githubUTCDateFormat)
+	return generateDateRangeQuery(start, &e)
+}
+
+// split splits the range into two halves at the second, it returns false
+// if the range can not be split any more.
+func (r dateRange) split(now time.Time) (dateRange, dateRange, bool) {
+	start, end := githubEpoch, now.UTC()
+	if r.start != nil {
+		start = *r.start
+	}
+	if r.end != nil {
+		end = *r.end
+	}
+	if !end.After(start) {
+		return r, r, false
+	}
+	mid := start.Add(end.Sub(start) / 2).Truncate(time.Second)
+	next := mid.Add(time.Second)
+	return dateRange{start: r.start, end: &mid}, dateRange{start: &next, end: r.end}, true
+}
+
+// searchAllIssues searches the issues, and bisects the date range of the
+// query until the results of every part fit in the search limit.
+func (r *Reporter) searchAllIssues(bySort string, queryArgs map[string]string) ([]github.Issue, error) {
+	query := r.buildSearchQuery(queryArgs)
+	issues, truncated, err := r.issues.SearchIssues(query, bySort)
+	if err != nil || !truncated {
+		return issues, err
+	}
+
+	for _, key := range githubDateQualifiers {
+		value, ok := queryArgs[key]
+		if !ok {
+			continue
+		}
+		dr, err := parseDateRangeQuery(value)
+		if err != nil {
+			continue
+		}
+		left, right, ok := dr.split(time.Now())
+		if !ok {
+			break
+		}
+
+		seen := make(map[string]struct{})
+		var all []github.Issue
+		for _, part := range []dateRange{left, right} {
+			args := make(map[string]string, len(queryArgs))
+			for k, v := range queryArgs {
+				args[k] = v
+			}
+			args[key] = part.query()
+			issues, err := r.searchAllIssues(bySort, args)
+			if err != nil {
+				return nil, err
+			}
+			// The issue may move between the parts when the range is open.
+			for _, issue := range issues {
+				if _, ok := seen[issue.GetHTMLURL()]; !ok {
+					seen[issue.GetHTMLURL()] = struct{}{}
+					all = append(all, issue)
+				}
+			}
+		}
+		return all, nil
+	}
+	return nil, fmt.Errorf("search %q has more than %d results, narrow the date range", query, githubSearchLimit)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDateRangeQuery(t *testing.T) {
+	tests := []struct {
+		value string
+		query string
+	}{
+		{"2018-10-01T00:00:00Z..2018-10-08T00:00:00Z", "2018-10-01T00:00:00Z..2018-10-08T00:00:00Z"},
+		{"2018-10-01..2018-10-07", "2018-10-01T00:00:00Z..2018-10-07T23:59:59Z"},
+		{">=2018-10-01T00:00:00Z", ">=2018-10-01T00:00:00Z"},
+		{">2018-10-01T00:00:00Z", ">=2018-10-01T00:00:01Z"},
+		{">2018-10-01", ">=2018-10-02T00:00:00Z"},
+		{"<2018-10-08T00:00:00Z", "<2018-10-08T00:00:00Z"},
+		{"<=2018-10-07", "<2018-10-08T00:00:00Z"},
+	}
+	for _, test := range tests {
+		r, err := parseDateRangeQuery(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q := r.query(); q != test.query {
+			t.Errorf("%s: got %s, expect %s", test.value, q, test.query)
+		}
+	}
+
+	if _, err := parseDateRangeQuery("2018-10-01"); err == nil {
+		t.Error("expect error for a single date")
+	}
+}
+
+func TestDateRangeSplit(t *testing.T) {
+	r, _ := parseDateRangeQuery("2018-10-01T00:00:00Z..2018-10-01T00:00:03Z")
+	left, right, ok := r.split(time.Now())
+	if !ok || left.query() != "2018-10-01T00:00:00Z..2018-10-01T00:00:01Z" || right.query() != "2018-10-01T00:00:02Z..2018-10-01T00:00:03Z" {
+		t.Fatalf("unexpected split %s, %s", left.query(), right.query())
+	}
+
+	// An open range after the time is split too.
+	r, _ = parseDateRangeQuery(">2018-10-01T00:00:00Z")
+	now := time.Date(2018, 10, 1, 0, 0, 5, 0, time.UTC)
+	left, right, ok = r.split(now)
+	if !ok || left.query() != "2018-10-01T00:00:01Z..2018-10-01T00:00:03Z" || right.query() != ">=2018-10-01T00:00:04Z" {
+		t.Fatalf("unexpected split %s, %s", left.query(), right.query())
+	}
+
+	r, _ = parseDateRangeQuery("2018-10-01T00:00:00Z..2018-10-01T00:00:00Z")
+	if _, _, ok := r.split(time.Now()); ok {
+		t.Fatal("expect a single second can not be split")
+	}
+}
+
+var regexMergedQuery = regexp.MustCompile(`merged:(\S+)`)
+
+func TestSearchIssuesBisectsDateRange(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	// One PR is merged every day, and the fake search returns at most 2
+	// results.
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	env.github.handle("GET", "/search/issues", func(r *http.Request, body string) interface{} {
+		dr, err := parseDateRangeQuery(regexMergedQuery.FindStringSubmatch(r.URL.Query().Get("q"))[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []map[string]interface{}
+		for i := 0; i < 7; i++ {
+			merged := start.Add(time.Duration(i) * 24 * time.Hour)
+			if !merged.Before(*dr.start) && !merged.After(*dr.end) {
+				items = append(items, githubIssue(i, "pull", fmt.Sprintf("PR %d", i), "alice"))
+			}
+		}
+		if len(items) > 2 {
+			result := githubSearchResult()
+			result["total_count"] = githubSearchLimit + 1
+			return result
+		}
+		return githubSearchResult(items...)
+	})
+
+	since, until := "2018-10-01T00:00:00Z", "2018-10-08T00:00:00Z"
+	issues, err := env.reporter.getMergedPullRequests(&since, &until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for _, issue := range issues {
+		numbers = append(numbers, issue.GetNumber())
+	}
+	if expect := []int{0, 1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(numbers, expect) {
+		t.Fatalf("got %v, expect %v", numbers, expect)
+	}
+	if n := len(env.github.requestsTo("GET", "/search/issues")); n < 3 {
+		t.Fatalf("expect the range bisected, got %d searches", n)
+	}
+}
+
+func TestSearchIssuesOverLimitWithoutDateRange(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	result := githubSearchResult()
+	result["total_count"] = githubSearchLimit + 1
+	result["incomplete_results"] = true
+	env.github.reply("GET", "/search/issues", result)
+
+	if _, err := env.reporter.getIssues("created", map[string]string{"is": "issue"}); err == nil {
+		t.Fatal("expect error for the truncated results")
+	}
+}
+
+func TestSearchIssuesTimeout(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	// GitHub times out with the partial results, which are not bisected.
+	result := githubSearchResult(githubIssue(1, "issues", "Issue 1", "alice"))
+	result["incomplete_results"] = true
+	env.github.reply("GET", "/search/issues", result)
+
+	start := "2018-10-01T00:00:00Z"
+	issues, err := env.reporter.getIssues("created", map[string]string{"is": "issue", "created": ">" + start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 {
+		t.Fatalf("expect the partial results, got %d issues", len(issues))
+	}
+	if n := len(env.github.requestsTo("GET", "/search/issues")); n != 2 {
+		t.Fatalf("expect the search retried once, got %d searches", n)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func TestIssueRepo(t *testing.T) {
+	tbl := []struct {
+		issue  github.Issue
+		expect string
+	}{
+		{github.Issue{HTMLURL: github.String("https://github.com/tikv/tikv/issues/1")}, "tikv/tikv"},
+		{github.Issue{HTMLURL: github.String("https://github.example.com/tikv/pd/pull/2")}, "tikv/pd"},
+		{github.Issue{
+			HTMLURL:       github.String("https://github.example.com/tikv/pd/pull/2"),
+			RepositoryURL: github.String("https://github.example.com/api/v3/repos/pingcap/pd"),
+		}, "pingcap/pd"},
+	}
+	for _, c := range tbl {
+		repo, err := issueRepo(c.issue)
+		if err != nil || repo != c.expect {
+			t.Errorf("%s: expect %s, got %s %v", c.issue.GetHTMLURL(), c.expect, repo, err)
+		}
+	}
+
+	if _, err := issueRepo(github.Issue{HTMLURL: github.String("https://example.com/tikv")}); err == nil {
+		t.Error("expect error for unknown URL")
+	}
+}
+
+func TestGetReviewPullRequestsUnknownRepo(t *testing.T) {
+	m := &memServices{
+		githubIssues: []github.Issue{
+			{Number: github.Int(1), HTMLURL: github.String("https://github.example.com/tikv")},
+		},
+	}
+	r := newMemReporter(t, m)
+
+	_, err := r.getReviewPullRequests("siddontang", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown repository") {
+		t.Fatalf("expect the unknown repository reported, got %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func githubIssue(number int, kind string, title string, login string, assignees ...string) map[string]interface{} {
+	var as []interface{}
+	for _, a := range assignees {
+		as = append(as, map[string]string{"login": a})
+	}
+	return map[string]interface{}{
+		"number":    number,
+		"html_url":  fmt.Sprintf("https://github.com/tikv/tikv/%s/%d", kind, number),
+		"title":     title,
+		"state":     "open",
+		"user":      map[string]string{"login": login},
+		"assignees": as,
+	}
+}
+
+func githubSearchResult(items ...map[string]interface{}) map[string]interface{} {
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"total_count":        len(items),
+		"incomplete_results": false,
+		"items":              items,
+	}
+}
+
+func jiraSearchResult(issues ...map[string]interface{}) map[string]interface{} {
+	if issues == nil {
+		issues = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"startAt":    0,
+		"maxResults": 1000,
+		"total":      len(issues),
+		"issues":     issues,
+	}
+}
+
+func jiraSprint(id int, name string, state string, start time.Time, end time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            id,
+		"name":          name,
+		"state":         state,
+		"startDate":     start.Format(time.RFC3339),
+		"endDate":       end.Format(time.RFC3339),
+		"originBoardId": 1,
+	}
+}
+
+func (env *fakeEnv) replyBoard() {
+	env.jira.reply("GET", "/rest/agile/1.0/board", map[string]interface{}{
+		"isLast": true,
+		"values": []interface{}{map[string]interface{}{"id": 1, "name": "TIKV board", "type": "scrum"}},
+	})
+}
+
+func TestDailyReport(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	now := time.Date(2018, 10, 5, 8, 0, 0, 0, time.UTC)
+
+	env.github.handle("GET", "/search/issues", func(r *http.Request, body string) interface{} {
+		q := r.URL.Query().Get("q")
+		if strings.Contains(q, "is:issue") {
+			return githubSearchResult(githubIssue(1, "issues", "Issue one", "siddontang"))
+		}
+		return githubSearchResult(githubIssue(2, "pull", "PR <two>", "alice", "siddontang"))
+	})
+	env.jira.handle("GET", "/rest/api/2/search", func(r *http.Request, body string) interface{} {
+		jql := r.URL.Query().Get("jql")
+		if strings.Contains(jql, "created") {
+			return jiraSearchResult(map[string]interface{}{
+				"id":  "10001",
+				"key": "OC-1",
+				"fields": map[string]interface{}{
+					"summary":  "Server down",
+					"status":   map[string]string{"name": "Open"},
+					"priority": map[string]string{"name": "Highest"},
+					"assignee": map[string]string{"name": "tl", "emailAddress": "TL@pingcap.com"},
+				},
+			})
+		}
+		return jiraSearchResult()
+	})
+
+	if err := env.reporter.runDailyReport(now); err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []string
+	for _, req := range env.github.requestsTo("GET", "/search/issues") {
+		queries = append(queries, parseForm(t, req.Query).Get("q"))
+	}
+	expectQueries := []string{
+		"repo:tikv/tikv is:issue created:>=2018-10-04T08:00:00Z",
+		"repo:tikv/tikv is:pr created:>=2018-10-04T08:00:00Z",
+	}
+	if len(queries) != len(expectQueries) {
+		t.Fatalf("expect github queries %q, got %q", expectQueries, queries)
+	}
+	for i, q := range queries {
+		// The order of the qualifiers is not stable.
+		for _, part := range strings.Fields(expectQueries[i]) {
+			if !strings.Contains(q, part) {
+				t.Errorf("expect github query %q to contain %q", q, part)
+			}
+		}
+	}
+
+	var jqls []string
+	for _, req := range env.jira.requestsTo("GET", "/rest/api/2/search") {
+		jqls = append(jqls, parseForm(t, req.Query).Get("jql"))
+	}
+	expectJQLs := []string{
+		`project = OC AND created >= "-1d"`,
+		`project = OC AND priority >= "Highest" AND resolution = Unresolved AND updated <= "-3d"`,
+	}
+	if strings.Join(jqls, "\n") != strings.Join(expectJQLs, "\n") {
+		t.Errorf("expect jqls %q, got %q", expectJQLs, jqls)
+	}
+
+	expect := "*Daily Report*\n\n" +
+		"*New Issues*\n> New issues in last 24 hours\n" +
+		"• [ tikv/tikv ] <https://github.com/tikv/tikv/issues/1|Issue one> by @siddontang\n\n" +
+		"*New Pull Requests*\n> New PRs in last 24 hours\n" +
+		"• [ tikv/tikv ] _(Community)_ <https://github.com/tikv/tikv/pull/2|PR &lt;two&gt;> by @alice, assigned to @siddontang\n\n" +
+		"*New OnCalls*\n> New on calls in last 24 hours\n" +
+		fmt.Sprintf("• [ Open / Highest ] <%sbrowse/OC-1|Server down> assigned to <@U1>\n\n", env.reporter.config.Jira.Endpoint) +
+		"*Inactive OnCalls*\n> Highest priority on calls inactive &gt;= 3 days\n" +
+		"_None_\n\n"
+	msgs := env.slackMessages()
+	if len(msgs) != 1 || msgs[0] != expect {
+		t.Errorf("expect slack message:\n%s\ngot:\n%q", expect, msgs)
+	}
+}
+
+func TestDailyReportPartialFailure(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	env.github.reply("GET", "/search/issues", githubSearchResult())
+	env.jira.reply("GET", "/rest/api/2/search", fakeFailure{Status: http.StatusInternalServerError, Message: "boom"})
+
+	err := env.reporter.runDailyReport(time.Now())
+	if err == nil || !strings.Contains(err.Error(), "2 report sections failed") {
+		t.Fatalf("expect the OnCall sections to fail, got %v", err)
+	}
+
+	msgs := env.slackMessages()
+	if len(msgs) != 1 {
+		t.Fatalf("expect the partial report to be sent, got %q", msgs)
+	}
+	if !strings.Contains(msgs[0], "*New Issues*\n> New issues in last 24 hours\n_None_\n") {
+		t.Errorf("expect the GitHub sections to be rendered, got:\n%s", msgs[0])
+	}
+	if strings.Count(msgs[0], "_failed to load: ") != 2 {
+		t.Errorf("expect the OnCall sections to be placeholders, got:\n%s", msgs[0])
+	}
+}
+
+func TestDailyReportPerTeam(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	cfg := env.reporter.config
+	cfg.Teams = []Team{
+		{Name: "Storage", Channel: "storage", Repos: []string{"tikv/tikv"}, Project: "STORAGE"},
+		{Name: "Scheduling", Channel: "#scheduling", Repos: []string{"pingcap/pd"}},
+		{Name: "Idle"},
+	}
+	cfg.Daily.Sections = []DailySection{
+		{Title: "New Issues", Github: map[string]string{"is": "issue"}, Sort: "created"},
+		{Title: "Bugs", JQL: "project = {project} AND type = Bug"},
+	}
+	env.github.reply("GET", "/search/issues", githubSearchResult())
+	env.jira.reply("GET", "/rest/api/2/search", jiraSearchResult())
+
+	if err := env.reporter.runDailyReport(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var queries, jqls []string
+	for _, req := range env.github.requestsTo("GET", "/search/issues") {
+		queries = append(queries, parseForm(t, req.Query).Get("q"))
+	}
+	for _, req := range env.jira.requestsTo("GET", "/rest/api/2/search") {
+		jqls = append(jqls, parseForm(t, req.Query).Get("jql"))
+	}
+	expectQueries := []string{"repo:tikv/tikv is:issue", "repo:pingcap/pd is:issue", "repo:tikv/tikv is:issue"}
+	if strings.Join(queries, "\n") != strings.Join(expectQueries, "\n") {
+		t.Errorf("expect github queries %q, got %q", expectQueries, queries)
+	}
+	// The team without a project uses the global one.
+	expectJQLs := []string{"project = STORAGE AND type = Bug", "project = TIKV AND type = Bug", "project = TIKV AND type = Bug"}
+	if strings.Join(jqls, "\n") != strings.Join(expectJQLs, "\n") {
+		t.Errorf("expect jqls %q, got %q", expectJQLs, jqls)
+	}
+
+	var channels []string
+	for _, req := range env.slack.requestsTo("POST", "/api/chat.postMessage") {
+		channels = append(channels, parseForm(t, req.Body).Get("channel"))
+	}
+	// The team without a channel uses the global one.
+	if strings.Join(channels, " ") != "#storage #scheduling #team" {
+		t.Errorf("expect one report per team channel, got %q", channels)
+	}
+	msgs := env.slackMessages()
+	if len(msgs) != 3 || !strings.HasPrefix(msgs[0], "*Daily Report - Storage*") ||
+		!strings.HasPrefix(msgs[1], "*Daily Report - Scheduling*") || !strings.HasPrefix(msgs[2], "*Daily Report - Idle*") {
+		t.Errorf("unexpected messages %q", msgs)
+	}
+}
+
+func TestDailyReportTeamsOwnIssues(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	cfg := env.reporter.config
+	cfg.Teams = []Team{
+		{Name: "Storage", Channel: "storage", Repos: []string{"tikv/tikv"}, OnCall: "SOC"},
+		{Name: "Scheduling", Channel: "scheduling", Repos: []string{"pingcap/pd"}, OnCall: "POC"},
+	}
+	cfg.Daily.Sections = []DailySection{
+		{Title: "New Issues", Github: map[string]string{"is": "issue"}, Sort: "created"},
+		{Title: "New OnCalls", OnCall: dailyOnCallNew},
+	}
+	regexRepoQuery := regexp.MustCompile(`repo:(\S+)`)
+	env.github.handle("GET", "/search/issues", func(r *http.Request, body string) interface{} {
+		repo := regexRepoQuery.FindStringSubmatch(r.URL.Query().Get("q"))[1]
+		issue := githubIssue(1, "issues", "Issue of "+repo, "alice")
+		issue["html_url"] = fmt.Sprintf("https://github.com/%s/issues/1", repo)
+		return githubSearchResult(issue)
+	})
+	env.jira.handle("GET", "/rest/api/2/search", func(r *http.Request, body string) interface{} {
+		project := strings.Fields(r.URL.Query().Get("jql"))[2]
+		return jiraSearchResult(map[string]interface{}{
+			"id": "1", "key": project + "-1", "fields": map[string]interface{}{"summary": "OnCall of " + project},
+		})
+	})
+
+	if err := env.reporter.runDailyReport(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := env.slackMessages()
+	if len(msgs) != 2 {
+		t.Fatalf("expect one report per team, got %q", msgs)
+	}
+	scopes := [][2]string{{"tikv/tikv", "SOC"}, {"pingcap/pd", "POC"}}
+	for i, expect := range scopes {
+		other := scopes[1-i]
+		if !strings.Contains(msgs[i], "Issue of "+expect[0]) || !strings.Contains(msgs[i], "OnCall of "+expect[1]) {
+			t.Errorf("expect the issues of %v, got:\n%s", expect, msgs[i])
+		}
+		if strings.Contains(msgs[i], other[0]) || strings.Contains(msgs[i], other[1]) {
+			t.Errorf("expect no issue of %v, got:\n%s", other, msgs[i])
+		}
+	}
+}
+
+func TestWeeklyReport(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	now := time.Now()
+	start := now.Add(-2 * 24 * time.Hour).Truncate(time.Second)
+	end := start.Add(week)
+	sprintName := fmt.Sprintf("TIKV %s - %s", start.Format(dayFormat), end.Add(-time.Second).Format(dayFormat))
+
+	env.replyBoard()
+	env.jira.reply("GET", "/rest/agile/1.0/board/1/sprint", map[string]interface{}{
+		"isLast": true,
+		"values": []interface{}{jiraSprint(7, sprintName, "active", start, end)},
+	})
+	env.jira.reply("GET", "/rest/api/2/search", jiraSearchResult(map[string]interface{}{
+		"id":     "10002",
+		"key":    "TIKV-2",
+		"fields": map[string]interface{}{"summary": "Task", "customfield_10100": "TIKV-1"},
+	}))
+	env.jira.reply("GET", "/rest/api/2/field", []interface{}{
+		map[string]interface{}{"id": "summary", "name": "Summary"},
+		map[string]interface{}{"id": "customfield_10100", "name": "Epic Link", "custom": true},
+		map[string]interface{}{"id": "customfield_10102", "name": "Epic Name", "custom": true},
+		map[string]interface{}{"id": "customfield_10949", "name": "Collaborators", "custom": true},
+	})
+	env.jira.reply("GET", "/rest/api/2/issue/TIKV-1", map[string]interface{}{
+		"id":  "10001",
+		"key": "TIKV-1",
+		"fields": map[string]interface{}{
+			"summary":           "Epic",
+			"assignee":          map[string]string{"name": "tl"},
+			"customfield_10102": "Raft Engine",
+			"customfield_10949": []interface{}{map[string]string{"name": "bob"}},
+		},
+	})
+	env.github.handle("GET", "/search/issues", func(r *http.Request, body string) interface{} {
+		if strings.Contains(r.URL.Query().Get("q"), "is:issue") {
+			return githubSearchResult(githubIssue(1, "issues", "Issue one", "alice"))
+		}
+		return githubSearchResult(githubIssue(2, "pull", "PR two", "siddontang"))
+	})
+	review := func(login, state string, at time.Time) map[string]interface{} {
+		return map[string]interface{}{"user": map[string]string{"login": login}, "state": state, "submitted_at": at}
+	}
+	env.github.reply("GET", "/repos/tikv/tikv/pulls/2/reviews", []interface{}{
+		review("siddontang", "COMMENTED", start.Add(-time.Hour)),
+		review("siddontang", "CHANGES_REQUESTED", start.Add(time.Hour)),
+		review("bob", "APPROVED", start.Add(time.Hour)),
+		review("siddontang", "APPROVED", start.Add(2*time.Hour)),
+	})
+	env.confluence.handle("GET", "/rest/api/content", func(r *http.Request, body string) interface{} {
+		if r.URL.Query().Get("title") == "Weekly Reports" {
+			return map[string]interface{}{"results": []interface{}{map[string]string{"id": "100"}}}
+		}
+		return map[string]interface{}{"results": []interface{}{}}
+	})
+	pageID := 200
+	env.confluence.handle("POST", "/rest/api/content", func(r *http.Request, body string) interface{} {
+		pageID++
+		return map[string]interface{}{
+			"id":     fmt.Sprint(pageID),
+			"_links": map[string]string{"webui": fmt.Sprintf("/pages/%d", pageID)},
+		}
+	})
+
+	if err := env.reporter.runWeeklyReport(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := env.confluence.requestsTo("POST", "/rest/api/content")
+	if len(pages) != 2 {
+		t.Fatalf("expect the report page and one user page, got %d pages", len(pages))
+	}
+	var report, userPage Content
+	if err := json.Unmarshal([]byte(pages[0].Body), &report); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(pages[1].Body), &userPage); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Title != sprintName || report.Space.Key != "TT" || len(report.Ancestors) != 1 || report.Ancestors[0].Id != "100" {
+		t.Errorf("unexpected report page %+v", report)
+	}
+	for _, s := range []string{
+		`<a href="https://github.com/tikv/tikv/issues/1">Issue one</a> by @alice`,
+		`<a href="https://github.com/tikv/tikv/pull/2">PR two</a> by @siddontang`,
+		// The page body is escaped again by escaperValue.
+		`project = OC AND priority &amp;gt;= &amp;#34;Highest&amp;#34; AND resolution = Unresolved`,
+		`<td>Raft Engine</td>`,
+		`<ac:link><ri:user ri:username="tl" /></ac:link>*<br /><ac:link><ri:user ri:username="bob" /></ac:link>`,
+		`project = TIKV and cf[10100] = TIKV-1 and Sprint = 7`,
+	} {
+		if !strings.Contains(report.Body.Storage.Value, s) {
+			t.Errorf("expect report page to contain %q", s)
+		}
+	}
+
+	if userPage.Title != "Siddon Tang - "+sprintName || userPage.Ancestors[0].Id != "201" {
+		t.Errorf("unexpected user page %+v", userPage)
+	}
+	for _, s := range []string{
+		`project = TIKV AND Sprint = 7 AND assignee = &amp;#34;tl@pingcap.com&amp;#34;`,
+		"<h3>Merged PR</h3>\n<ul><li>",
+		// The review before the sprint and the one by others are not counted.
+		"<h3>Review PR</h3>\n\n<blockquote>1 PRs reviewed, 1 approvals, 1 changes requested</blockquote>\n<ul><li>",
+		"Changes Requested x1",
+	} {
+		if !strings.Contains(userPage.Body.Storage.Value, s) {
+			t.Errorf("expect user page to contain %q, got %s", s, userPage.Body.Storage.Value)
+		}
+	}
+
+	githubRange := fmt.Sprintf("%s..%s", start.UTC().Format(githubUTCDateFormat), end.UTC().Format(githubUTCDateFormat))
+	var userQueries []string
+	for _, req := range env.github.requestsTo("GET", "/search/issues") {
+		if q := parseForm(t, req.Query).Get("q"); strings.Contains(q, "siddontang") {
+			userQueries = append(userQueries, q)
+		}
+	}
+	if len(userQueries) != 2 ||
+		!strings.Contains(userQueries[0], "author:siddontang") || !strings.Contains(userQueries[0], "merged:"+githubRange) ||
+		!strings.Contains(userQueries[1], "reviewed-by:siddontang") ||
+		!strings.Contains(userQueries[1], "updated:>="+start.UTC().Format(githubUTCDateFormat)) {
+		t.Errorf("unexpected user queries %q", userQueries)
+	}
+
+	expect := fmt.Sprintf("Weekly report for sprint %s is generated: %s/pages/201", sprintName, env.reporter.config.Confluence.Endpoint)
+	if msgs := env.slackMessages(); len(msgs) != 1 || msgs[0] != expect {
+		t.Errorf("expect slack message %q, got %q", expect, msgs)
+	}
+}
+
+func TestRotateSprint(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	end := start.Add(week)
+
+	env.replyBoard()
+	env.jira.handle("GET", "/rest/agile/1.0/board/1/sprint", func(r *http.Request, body string) interface{} {
+		var sprints []interface{}
+		if r.URL.Query().Get("state") == "active" {
+			sprints = append(sprints, jiraSprint(1, "TIKV 2018-09-28 - 2018-10-04", "active", start, end))
+		}
+		return map[string]interface{}{"isLast": true, "values": sprints}
+	})
+	env.jira.reply("POST", "/rest/agile/1.0/sprint", map[string]interface{}{
+		"id": 2, "name": "TIKV 2018-10-05 - 2018-10-11", "state": "future",
+	})
+	env.jira.reply("GET", "/rest/api/2/search", jiraSearchResult(
+		map[string]interface{}{"id": "10001", "key": "TIKV-1"},
+		map[string]interface{}{"id": "10002", "key": "TIKV-2"},
+	))
+	env.jira.reply("POST", "/rest/agile/1.0/sprint/2/issue", nil)
+	env.jira.reply("POST", "/rest/agile/1.0/sprint/1", map[string]interface{}{"id": 1})
+	env.jira.reply("POST", "/rest/agile/1.0/sprint/2", map[string]interface{}{"id": 2})
+
+	if err := env.reporter.rotateSprint(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	var mutations []string
+	for _, req := range env.jira.requests {
+		if req.Method == "POST" {
+			mutations = append(mutations, req.Path+" "+strings.TrimSpace(req.Body))
+		}
+	}
+	expectMutations := []string{
+		`/rest/agile/1.0/sprint {"endDate":"2018-10-12T00:00:00Z","name":"TIKV 2018-10-05 - 2018-10-11","originBoardId":"1","startDate":"2018-10-05T00:00:00Z"}`,
+		`/rest/agile/1.0/sprint/2/issue {"issues":["10001","10002"]}`,
+		`/rest/agile/1.0/sprint/1 {"state":"closed"}`,
+		`/rest/agile/1.0/sprint/2 {"state":"active"}`,
+	}
+	if strings.Join(mutations, "\n") != strings.Join(expectMutations, "\n") {
+		t.Errorf("expect mutations:\n%s\ngot:\n%s", strings.Join(expectMutations, "\n"), strings.Join(mutations, "\n"))
+	}
+
+	expect := "Current active Sprint TIKV 2018-09-28 - 2018-10-04 is closed, 2 unresolved issues are moved to Sprint TIKV 2018-10-05 - 2018-10-11"
+	if msgs := env.slackMessages(); len(msgs) != 1 || msgs[0] != expect {
+		t.Errorf("expect slack message %q, got %q", expect, msgs)
+	}
+}
+
+func TestRotateSprintDryRun(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	env.reporter.dryRun = true
+
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	env.replyBoard()
+	env.jira.handle("GET", "/rest/agile/1.0/board/1/sprint", func(r *http.Request, body string) interface{} {
+		var sprints []interface{}
+		if r.URL.Query().Get("state") == "active" {
+			sprints = append(sprints, jiraSprint(1, "TIKV 2018-09-28 - 2018-10-04", "active", start, start.Add(week)))
+		}
+		return map[string]interface{}{"isLast": true, "values": sprints}
+	})
+	env.jira.reply("GET", "/rest/api/2/search", jiraSearchResult())
+
+	if err := env.reporter.rotateSprint(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range env.jira.requests {
+		if req.Method != "GET" {
+			t.Errorf("unexpected mutation %s %s in dry-run mode", req.Method, req.Path)
+		}
+	}
+	if msgs := env.slackMessages(); len(msgs) != 0 {
+		t.Errorf("unexpected slack messages %q in dry-run mode", msgs)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -12,39 +13,77 @@ import (
 const (
 	dayFormat  = "2006-01-02"
 	dateFormat = "2006-01-02T15:04:05Z07:00"
-	// We use one week for a sprint
-	sprintDuration = 7 * 24 * time.Hour
+	// The unit of the sprint length, see Sprint.Weeks.
+	week = 7 * 24 * time.Hour
 )
 
+// jiraService is the IssueTracker and SprintManager backed by the Jira REST API.
+type jiraService struct {
+	client *jira.Client
+	// freshClient bypasses the cache of client.
+	freshClient *jira.Client
+}
+
+// newJiraService creates the service sending the requests through the
+// transport, and the ones which must not be cached through the fresh
+// transport. The default transport is used if they are nil.
+func newJiraService(cfg Jira, base http.RoundTripper, fresh http.RoundTripper) (*jiraService, error) {
+	newClient := func(base http.RoundTripper) (*jira.Client, error) {
+		transport := jira.BasicAuthTransport{
+			Username:  cfg.User,
+			Password:  cfg.Password,
+			Transport: base,
+		}
+		return jira.NewClient(transport.Client(), cfg.Endpoint)
+	}
+
+	client, err := newClient(base)
+	if err != nil {
+		return nil, err
+	}
+	freshClient, err := newClient(fresh)
+	if err != nil {
+		return nil, err
+	}
+	return &jiraService{client: client, freshClient: freshClient}, nil
+}
+
 // Get the board ID by project and boardType.
 // Here we assume that you must create a board in the project and
 // the function will return the first board ID.
-func getBoardID(project string, boardType string) int {
+func (s *jiraService) GetBoardID(project string, boardType string) (int, error) {
 	opts := jira.BoardListOptions{
 		BoardType:      boardType,
 		ProjectKeyOrID: project,
 	}
 
-	boards, _, err := jiraClient.Board.GetAllBoards(&opts)
-	perror(err)
+	boards, _, err := s.client.Board.GetAllBoards(&opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(boards.Values) == 0 {
+		return 0, fmt.Errorf("no %s board in project %s", boardType, project)
+	}
 
-	return boards.Values[0].ID
+	return boards.Values[0].ID, nil
 }
 
-func getSprints(boardID int, opts jira.GetAllSprintsOptions) []jira.Sprint {
+func (s *jiraService) GetSprints(boardID int, state string) ([]jira.Sprint, error) {
 	var allSprints []jira.Sprint
 
 	pos := 0
 	for {
 		nextOpts := &jira.GetAllSprintsOptions{
-			State: opts.State,
+			State: state,
 			SearchOptions: jira.SearchOptions{
 				StartAt:    pos,
 				MaxResults: 100,
 			},
 		}
-		results, _, err := jiraClient.Board.GetAllSprintsWithOptions(boardID, nextOpts)
-		perror(err)
+		results, _, err := s.client.Board.GetAllSprintsWithOptions(boardID, nextOpts)
+		if err != nil {
+			return nil, err
+		}
 		allSprints = append(allSprints, results.Values...)
 
 		if results.IsLast {
@@ -53,29 +92,153 @@ func getSprints(boardID int, opts jira.GetAllSprintsOptions) []jira.Sprint {
 		pos += len(results.Values)
 	}
 
-	return allSprints
+	return allSprints, nil
+}
+
+func (s *jiraService) CreateSprint(boardID int, name string, startDate, endDate string) (jira.Sprint, error) {
+	apiEndpoint := "rest/agile/1.0/sprint"
+	sprint := map[string]string{
+		"name":          name,
+		"startDate":     startDate,
+		"endDate":       endDate,
+		"originBoardId": strconv.Itoa(boardID),
+	}
+
+	req, err := s.client.NewRequest("POST", apiEndpoint, sprint)
+	if err != nil {
+		return jira.Sprint{}, err
+	}
+
+	responseSprint := new(jira.Sprint)
+	if _, err = s.client.Do(req, responseSprint); err != nil {
+		return jira.Sprint{}, err
+	}
+
+	return *responseSprint, nil
+}
+
+func (s *jiraService) UpdateSprint(sprintID int, args map[string]string) (jira.Sprint, error) {
+	apiEndpoint := "rest/agile/1.0/sprint/" + strconv.Itoa(sprintID)
+
+	req, err := s.client.NewRequest("POST", apiEndpoint, args)
+	if err != nil {
+		return jira.Sprint{}, err
+	}
+
+	responseSprint := new(jira.Sprint)
+	if _, err = s.client.Do(req, responseSprint); err != nil {
+		return jira.Sprint{}, err
+	}
+
+	return *responseSprint, nil
+}
+
+func (s *jiraService) DeleteSprint(sprintID int) error {
+	apiEndpoint := "rest/agile/1.0/sprint/" + strconv.Itoa(sprintID)
+
+	req, err := s.client.NewRequest("DELETE", apiEndpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Do(req, nil)
+	return err
+}
+
+// A pagination-aware alternative for SprintService.MoveIssuesToSprint.
+//
+// https://developer.atlassian.com/cloud/jira/software/rest/#api-rest-agile-1-0-sprint-sprintId-issue-post
+func (s *jiraService) MoveIssuesToSprint(sprintID int, issueIDs []string) error {
+	apiEndpoint := fmt.Sprintf("rest/agile/1.0/sprint/%d/issue", sprintID)
+
+	// The maximum number of issues that can be moved in one operation is 50.
+	batchMax := 50
+	for len(issueIDs) > 0 {
+		n := batchMax
+		if len(issueIDs) < n {
+			n = len(issueIDs)
+		}
+		payload := jira.IssuesWrapper{Issues: issueIDs[:n]}
+		req, err := s.client.NewRequest("POST", apiEndpoint, payload)
+		if err != nil {
+			return err
+		}
+		if _, err = s.client.Do(req, nil); err != nil {
+			return err
+		}
+		issueIDs = issueIDs[n:]
+	}
+	return nil
+}
+
+// The page size of the issue search, Jira may return fewer issues.
+const jiraSearchPageSize = 100
+
+func (s *jiraService) SearchIssues(jql string, opts jiraSearchOptions, f func(jira.Issue) error) error {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = []string{"*navigable"}
+	}
+	searchOpts := &jira.SearchOptions{
+		MaxResults: jiraSearchPageSize,
+		Expand:     opts.Expand,
+		Fields:     fields,
+	}
+	client := s.client
+	if opts.Fresh {
+		client = s.freshClient
+	}
+	for {
+		issues, resp, err := client.Issue.Search(jql, searchOpts)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			if err = f(issue); err != nil {
+				return err
+			}
+		}
+		// Page by the returned issues, Jira caps the max results.
+		searchOpts.StartAt += len(issues)
+		if len(issues) == 0 || searchOpts.StartAt >= resp.Total {
+			return nil
+		}
+	}
+}
+
+func (s *jiraService) GetIssue(key string) (*jira.Issue, error) {
+	issue, _, err := s.client.Issue.Get(key, nil)
+	return issue, err
+}
+
+func (r *Reporter) getBoardID() (int, error) {
+	return r.sprints.GetBoardID(r.config.Jira.Project, "scrum")
 }
 
 // Returns the only active sprint
-func getActiveSprint(boardID int) jira.Sprint {
-	sprints := getSprints(boardID, jira.GetAllSprintsOptions{
-		State: "active",
-	})
+func (r *Reporter) getActiveSprint(boardID int) (jira.Sprint, error) {
+	sprints, err := r.sprints.GetSprints(boardID, "active")
+	if err != nil {
+		return jira.Sprint{}, err
+	}
+	if len(sprints) == 0 {
+		return jira.Sprint{}, fmt.Errorf("no active sprint on board %d", boardID)
+	}
 	for _, sprint := range sprints {
-		if strings.Contains(sprint.Name, config.Jira.Project) {
+		if strings.Contains(sprint.Name, r.config.Jira.Project) {
 			// Only care about current project's sprints.
-			return sprint
+			return sprint, nil
 		}
 	}
-	return sprints[0]
+	return sprints[0], nil
 }
 
-func getLatestPassedSprint(sprints []jira.Sprint) *jira.Sprint {
+func (r *Reporter) getLatestPassedSprint(sprints []jira.Sprint) *jira.Sprint {
 	now := time.Now()
-	minDiff := time.Hour * 7 * 24
+	minDiff := r.config.Sprint.duration()
 	var minSprint *jira.Sprint
 	for idx, sprint := range sprints {
-		if !strings.Contains(sprint.Name, config.Jira.Project) {
+		if !strings.Contains(sprint.Name, r.config.Jira.Project) {
 			// Only care about current project's sprints.
 			continue
 		}
@@ -90,6 +253,7 @@ func getLatestPassedSprint(sprints []jira.Sprint) *jira.Sprint {
 		}
 		diff := now.Sub(*sprint.EndDate)
 		if diff < minDiff {
+			minDiff = diff
 			minSprint = &sprints[idx]
 		}
 	}
@@ -97,12 +261,12 @@ func getLatestPassedSprint(sprints []jira.Sprint) *jira.Sprint {
 	return minSprint
 }
 
-func getNearestFutureSprint(sprints []jira.Sprint) *jira.Sprint {
+func (r *Reporter) getNearestFutureSprint(sprints []jira.Sprint) *jira.Sprint {
 	now := time.Now()
-	minDiff := time.Hour * 7 * 24
+	minDiff := r.config.Sprint.duration()
 	var minSprint *jira.Sprint
 	for idx, sprint := range sprints {
-		if !strings.Contains(sprint.Name, config.Jira.Project) {
+		if !strings.Contains(sprint.Name, r.config.Jira.Project) {
 			// Only care about current project's sprints.
 			continue
 		}
@@ -113,6 +277,7 @@ func getNearestFutureSprint(sprints []jira.Sprint) *jira.Sprint {
 		}
 		diff := (*sprint.StartDate).Sub(now)
 		if diff < minDiff {
+			minDiff = diff
 			minSprint = &sprints[idx]
 		}
 	}
@@ -120,109 +285,159 @@ func getNearestFutureSprint(sprints []jira.Sprint) *jira.Sprint {
 	return minSprint
 }
 
-func createSprint(boardID int, name string, startDate, endDate string) jira.Sprint {
-	apiEndpoint := "rest/agile/1.0/sprint"
-	sprint := map[string]string{
-		"name":          name,
-		"startDate":     startDate,
-		"endDate":       endDate,
-		"originBoardId": strconv.Itoa(boardID),
+func (r *Reporter) createSprint(boardID int, name string, startDate, endDate string) (jira.Sprint, error) {
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("create sprint %q on board %d (%s - %s)", name, boardID, startDate, endDate), "")
+		return jira.Sprint{Name: name, OriginBoardID: boardID}, nil
 	}
-	req, err := jiraClient.NewRequest("POST", apiEndpoint, sprint)
-	perror(err)
 
-	responseSprint := new(jira.Sprint)
-	_, err = jiraClient.Do(req, responseSprint)
-	perror(err)
-
-	return *responseSprint
+	return r.sprints.CreateSprint(boardID, name, startDate, endDate)
 }
 
-func createNextSprint(boardID int, startDate time.Time) jira.Sprint {
-	// We assuem the sprint starts at 00:00 and ends at 00:00
-	// E.g, current sprint time range is 2018-09-28T00:00:00+08:00 2018-10-05T00:00:00+08:00
-	// So the next sprint is 2018-10-05T00:00:00+08:00, 2018-10-12T00:00:00+08:00
-	// The sprint name is 2018-10-05 - 2018-10-11
-	endDate := startDate.Add(sprintDuration)
-
-	name := fmt.Sprintf("%s %s - %s", config.Jira.Project, startDate.Format(dayFormat), endDate.Add(-time.Second).Format(dayFormat))
+// createNextSprint creates the sprint after the one ending at lastEndDate
+// with the configured cadence, or returns it if it is created already.
+func (r *Reporter) createNextSprint(boardID int, lastEndDate time.Time) (jira.Sprint, error) {
+	// The sprint ends when the next one starts, and the name is rendered
+	// with the last day. E.g, with 2 weeks starting on Friday, the sprint
+	// after 2018-09-21T00:00:00+08:00 - 2018-10-05T00:00:00+08:00 is
+	// 2018-10-05T00:00:00+08:00 - 2018-10-19T00:00:00+08:00, and the default
+	// name is "TIKV 2018-10-05 - 2018-10-18".
+	startDate := r.config.Sprint.nextStart(lastEndDate)
+	endDate := r.config.Sprint.end(startDate)
+
+	sprints, err := r.sprints.GetSprints(boardID, "")
+	if err != nil {
+		return jira.Sprint{}, err
+	}
+	// The number of the sprint follows the project's sprints started before.
+	number := 1
+	for _, sprint := range sprints {
+		if strings.Contains(sprint.Name, r.config.Jira.Project) && sprint.StartDate != nil && sprint.StartDate.Before(startDate) {
+			number++
+		}
+	}
+	name, err := r.config.Sprint.name(r.config.Jira.Project, startDate, endDate, number)
+	if err != nil {
+		return jira.Sprint{}, err
+	}
 
-	sprints := getSprints(boardID, jira.GetAllSprintsOptions{
-		State: "future",
-	})
 	for _, sprint := range sprints {
-		if sprint.Name == name {
-			return sprint
+		if sprint.State == "future" && sprint.Name == name {
+			return sprint, nil
 		}
 	}
 
-	return createSprint(boardID, name, startDate.Format(dateFormat), endDate.Format(dateFormat))
+	return r.createSprint(boardID, name, startDate.Format(dateFormat), endDate.Format(dateFormat))
 }
 
-func deleteSprint(sprintID int) {
-	apiEndpoint := "rest/agile/1.0/sprint/" + strconv.Itoa(sprintID)
-	req, err := jiraClient.NewRequest("DELETE", apiEndpoint, nil)
-	perror(err)
+func (r *Reporter) deleteSprint(sprintID int) error {
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("delete sprint %d", sprintID), "")
+		return nil
+	}
 
-	_, err = jiraClient.Do(req, nil)
-	perror(err)
+	return r.sprints.DeleteSprint(sprintID)
 }
 
-func updateSprintTime(sprintID int, startDate, endDate string) jira.Sprint {
-	return updateSprint(sprintID, map[string]string{
+func (r *Reporter) updateSprintTime(sprintID int, startDate, endDate string) (jira.Sprint, error) {
+	return r.updateSprint(sprintID, map[string]string{
 		"startDate": startDate,
 		"endDate":   endDate,
 	})
 }
 
-func updateSprintState(sprintID int, state string) jira.Sprint {
-	return updateSprint(sprintID, map[string]string{
+func (r *Reporter) updateSprintState(sprintID int, state string) (jira.Sprint, error) {
+	return r.updateSprint(sprintID, map[string]string{
 		"state": state,
 	})
 }
 
-func updateSprint(sprintID int, args map[string]string) jira.Sprint {
-	apiEndpoint := "rest/agile/1.0/sprint/" + strconv.Itoa(sprintID)
+func (r *Reporter) updateSprint(sprintID int, args map[string]string) (jira.Sprint, error) {
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("update sprint %d with %v", sprintID, args), "")
+		return jira.Sprint{ID: sprintID}, nil
+	}
 
-	req, err := jiraClient.NewRequest("POST", apiEndpoint, args)
-	perror(err)
+	return r.sprints.UpdateSprint(sprintID, args)
+}
 
-	responseSprint := new(jira.Sprint)
-	_, err = jiraClient.Do(req, responseSprint)
-	perror(err)
+func (r *Reporter) moveIssuesToSprint(sprintID int, issues []jira.Issue) error {
+	ids := make([]string, 0, len(issues))
+	keys := make([]string, 0, len(issues))
+	for _, ise := range issues {
+		ids = append(ids, ise.ID)
+		keys = append(keys, ise.Key)
+	}
+
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("move %d issues to sprint %d", len(issues), sprintID), strings.Join(keys, ", "))
+		return nil
+	}
 
-	return *responseSprint
+	return r.sprints.MoveIssuesToSprint(sprintID, ids)
 }
 
-// A pagination-aware alternative for SprintService.MoveIssuesToSprint.
-//
-// https://developer.atlassian.com/cloud/jira/software/rest/#api-rest-agile-1-0-sprint-sprintId-issue-post
-func moveIssuesToSprint(sprintID int, issues []jira.Issue) {
-	apiEndpoint := fmt.Sprintf("rest/agile/1.0/sprint/%d/issue", sprintID)
+// jiraSearchOptions selects the fields and the expanded sections of the
+// searched issues, all the navigable fields are returned if Fields is empty.
+// Fresh bypasses the cache, for the searches which the changes depend on.
+type jiraSearchOptions struct {
+	Fields []string
+	Expand string
+	Fresh  bool
+}
 
-	// The maximum number of issues that can be moved in one operation is 50.
-	batchMax := 50
-	buffer := make([]string, 0, batchMax)
-	total := len(issues)
-	for idx, ise := range issues {
-		buffer = append(buffer, ise.ID)
-		if len(buffer) == batchMax || idx+1 == total {
-			payload := jira.IssuesWrapper{Issues: buffer}
-			req, err := jiraClient.NewRequest("POST", apiEndpoint, payload)
-			perror(err)
-			_, err = jiraClient.Do(req, nil)
-			perror(err)
+func (r *Reporter) queryJiraIssues(jql string) ([]jira.Issue, error) {
+	return r.queryJiraIssuesWithOptions(jql, jiraSearchOptions{})
+}
 
-			// clear buffer
-			buffer = buffer[:0]
-		}
+func (r *Reporter) queryJiraIssuesWithOptions(jql string, opts jiraSearchOptions) ([]jira.Issue, error) {
+	var issues []jira.Issue
+	err := r.iterateJiraIssues(jql, opts, func(issue jira.Issue) error {
+		issues = append(issues, issue)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return issues, nil
 }
 
-func queryJiraIssues(jql string) []jira.Issue {
-	issues, _, err := jiraClient.Issue.Search(jql, &jira.SearchOptions{
-		MaxResults: 1000,
-	})
-	perror(err)
-	return issues
+// iterateJiraIssues calls f with every issue matching the JQL as the pages
+// are loaded, and stops at the first error returned by f.
+func (r *Reporter) iterateJiraIssues(jql string, opts jiraSearchOptions, f func(jira.Issue) error) error {
+	return r.tracker.SearchIssues(jql, opts, f)
+}
+
+// Returns the unresolved issues of the sprint in current project.
+func (r *Reporter) getUnresolvedSprintIssues(sprintID int) ([]jira.Issue, error) {
+	jql := fmt.Sprintf("project = %s AND Sprint = %d AND resolution = Unresolved", r.config.Jira.Project, sprintID)
+	// Only the IDs and the keys are used to move the issues, which must be
+	// loaded from Jira, otherwise the issues missing in the cache are left.
+	return r.queryJiraIssuesWithOptions(jql, jiraSearchOptions{Fields: []string{"summary"}, Fresh: true})
+}
+
+// Builds the JQL of the issues in the OnCall project matching all the conditions.
+func (j Jira) onCallJQL(conditions ...string) string {
+	return strings.Join(append([]string{fmt.Sprintf("project = %s", j.OnCall)}, conditions...), " AND ")
+}
+
+// Returns the JQL of the OnCalls created in [start, end), the end can be empty.
+// Both absolute dates like "2018-10-05" and relative ones like "-1d" are accepted.
+func (j Jira) newOnCallJQL(start string, end string) string {
+	conditions := []string{fmt.Sprintf("created >= %q", start)}
+	if len(end) > 0 {
+		conditions = append(conditions, fmt.Sprintf("created < %q", end))
+	}
+	return j.onCallJQL(conditions...)
+}
+
+// Returns the JQL of the unresolved OnCalls at or above the priority threshold.
+func (j Jira) urgentOnCallJQL() string {
+	return j.onCallJQL(fmt.Sprintf("priority >= %q", j.OnCallPriority), "resolution = Unresolved")
+}
+
+// Returns the JQL of the urgent OnCalls not updated in the inactive days.
+func (j Jira) inactiveOnCallJQL() string {
+	return j.onCallJQL(fmt.Sprintf("priority >= %q", j.OnCallPriority), "resolution = Unresolved",
+		fmt.Sprintf("updated <= \"-%dd\"", j.OnCallInactiveDays))
 }
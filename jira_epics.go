@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+// epicGroup is an epic with the stories in the sprint.
+type epicGroup struct {
+	key string
+	// The stories are linked by the parent field of Jira Cloud and the
+	// team-managed projects, not the classic "Epic Link" field.
+	byParent bool
+	stories  []pageStory
+}
+
+// getIssueEpic returns the epic of the issue by the "Epic Link" field, or
+// the parent field if the issue is not a sub-task.
+func getIssueEpic(issue *jira.Issue, epicLinkField string) (string, bool) {
+	if epic := jiraStringField(issue, epicLinkField); len(epic) > 0 {
+		return epic, false
+	}
+	if issue.Fields != nil && issue.Fields.Parent != nil && !issue.Fields.Type.Subtask {
+		return issue.Fields.Parent.Key, true
+	}
+	return "", false
+}
+
+func newPageStory(issue *jira.Issue) pageStory {
+	s := pageStory{key: issue.Key}
+	if issue.Fields != nil {
+		s.summary = issue.Fields.Summary
+		if issue.Fields.Status != nil {
+			s.status = issue.Fields.Status.Name
+		}
+	}
+	return s
+}
+
+// epicStory is a story with its epic.
+type epicStory struct {
+	story    pageStory
+	epic     string
+	byParent bool
+}
+
+// epicGrouper groups the issues by the epics as they are loaded, and puts
+// the sub-tasks under their parent stories. Only the fields in the page are
+// kept instead of the whole issues.
+type epicGrouper struct {
+	epicLinkField string
+	stories       map[string]*epicStory
+	subtasks      map[string][]pageStory
+}
+
+func newEpicGrouper(epicLinkField string) *epicGrouper {
+	return &epicGrouper{
+		epicLinkField: epicLinkField,
+		stories:       make(map[string]*epicStory),
+		subtasks:      make(map[string][]pageStory),
+	}
+}
+
+// searchOptions selects the fields the grouper needs.
+func (g *epicGrouper) searchOptions() jiraSearchOptions {
+	fields := []string{"summary", "status", "issuetype", "parent"}
+	if len(g.epicLinkField) > 0 {
+		fields = append(fields, g.epicLinkField)
+	}
+	return jiraSearchOptions{Fields: fields}
+}
+
+func (g *epicGrouper) add(issue jira.Issue) error {
+	if issue.Fields != nil && issue.Fields.Type.Subtask && issue.Fields.Parent != nil {
+		parent := issue.Fields.Parent.Key
+		g.subtasks[parent] = append(g.subtasks[parent], newPageStory(&issue))
+		return nil
+	}
+	epic, byParent := getIssueEpic(&issue, g.epicLinkField)
+	g.stories[issue.Key] = &epicStory{story: newPageStory(&issue), epic: epic, byParent: byParent}
+	return nil
+}
+
+// groupIssuesByEpic returns the epics with the stories added to the grouper.
+// The parent story not in the sprint is loaded to find its epic. The issues
+// without an epic are skipped.
+func (r *Reporter) groupIssuesByEpic(g *epicGrouper, errs *reportErrors) []*epicGroup {
+	var missing []string
+	for key := range g.subtasks {
+		if _, ok := g.stories[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	stories := make([]*jira.Issue, len(missing))
+	storyErrs := make([]error, len(missing))
+	r.runParallel(len(missing), func(i int) {
+		stories[i], storyErrs[i] = r.tracker.GetIssue(missing[i])
+	})
+	for i, key := range missing {
+		if storyErrs[i] != nil {
+			errs.add("Story "+key, storyErrs[i])
+			continue
+		}
+		g.add(*stories[i])
+	}
+
+	groups := make(map[string]*epicGroup)
+	for key, s := range g.stories {
+		if len(s.epic) == 0 {
+			continue
+		}
+		group, ok := groups[s.epic]
+		if !ok {
+			group = &epicGroup{key: s.epic, byParent: s.byParent}
+			groups[s.epic] = group
+		}
+
+		story := s.story
+		story.subtasks = g.subtasks[key]
+		sort.Slice(story.subtasks, func(i, j int) bool { return story.subtasks[i].key < story.subtasks[j].key })
+		group.stories = append(group.stories, story)
+	}
+
+	sorted := make([]*epicGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.stories, func(i, j int) bool { return group.stories[i].key < group.stories[j].key })
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].key < sorted[j].key })
+	return sorted
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+// The names of the custom fields to discover.
+const (
+	jiraFieldEpicLink      = "Epic Link"
+	jiraFieldEpicName      = "Epic Name"
+	jiraFieldCollaborators = "Collaborators"
+)
+
+func (s *jiraService) GetFields() ([]jira.Field, error) {
+	fields, _, err := s.client.Field.GetList()
+	return fields, err
+}
+
+// getJiraFields returns the IDs of the custom fields. The ones not in the
+// config are discovered by the names once, and are empty if not found.
+func (r *Reporter) getJiraFields() JiraFields {
+	r.jiraFieldsMu.Lock()
+	defer r.jiraFieldsMu.Unlock()
+	if r.jiraFieldsInit {
+		return r.jiraFields
+	}
+	r.jiraFieldsInit = true
+	r.jiraFields = r.config.Jira.Fields
+
+	if len(r.jiraFields.EpicLink) > 0 && len(r.jiraFields.EpicName) > 0 && len(r.jiraFields.Collaborators) > 0 {
+		return r.jiraFields
+	}
+
+	fields, err := r.tracker.GetFields()
+	if err != nil {
+		fmt.Printf("can not discover the jira custom fields, please configure [jira.fields]: %v\n", err)
+		return r.jiraFields
+	}
+	ids := make(map[string]string, len(fields))
+	for _, field := range fields {
+		ids[strings.ToLower(field.Name)] = field.ID
+	}
+	for _, f := range []struct {
+		id   *string
+		name string
+	}{
+		{&r.jiraFields.EpicLink, jiraFieldEpicLink},
+		{&r.jiraFields.EpicName, jiraFieldEpicName},
+		{&r.jiraFields.Collaborators, jiraFieldCollaborators},
+	} {
+		if len(*f.id) == 0 {
+			*f.id = ids[strings.ToLower(f.name)]
+		}
+	}
+	return r.jiraFields
+}
+
+// jiraFieldJQL returns the field with the ID in JQL, like cf[10100] for the
+// custom field customfield_10100, so the renamed or localized fields still
+// match. The name is used if the ID is unknown.
+func jiraFieldJQL(id string, name string) string {
+	if len(id) == 0 {
+		return fmt.Sprintf("%q", name)
+	}
+	if strings.HasPrefix(id, "customfield_") {
+		return fmt.Sprintf("cf[%s]", strings.TrimPrefix(id, "customfield_"))
+	}
+	return id
+}
+
+// jiraStringField returns the string value of the custom field, or empty
+// if the field is missing or not a string.
+func jiraStringField(issue *jira.Issue, id string) string {
+	if issue == nil || issue.Fields == nil || len(id) == 0 {
+		return ""
+	}
+	s, _ := issue.Fields.Unknowns[id].(string)
+	return s
+}
+
+// jiraUsersField returns the user names of the multi-user custom field,
+// the values which are not users are skipped.
+func jiraUsersField(issue *jira.Issue, id string) []string {
+	if issue == nil || issue.Fields == nil || len(id) == 0 {
+		return nil
+	}
+	values, _ := issue.Fields.Unknowns[id].([]interface{})
+	var names []string
+	for _, value := range values {
+		user, _ := value.(map[string]interface{})
+		if name, ok := user["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
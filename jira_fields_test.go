@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestWeeklyReportProjectsWithoutFields(t *testing.T) {
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	sprint := &jira.Sprint{ID: 7, StartDate: &start}
+
+	// No field is discovered, the epics are found by the parent field of
+	// the stories, and the sub-tasks go under their stories.
+	m := &memServices{
+		jiraIssues: []jira.Issue{
+			{Key: "TIKV-2", Fields: &jira.IssueFields{Summary: "Story", Parent: &jira.Parent{Key: "TIKV-1"}}},
+			{Key: "TIKV-3", Fields: &jira.IssueFields{Summary: "Sub-task",
+				Type: jira.IssueType{Subtask: true}, Parent: &jira.Parent{Key: "TIKV-2"}}},
+			// The parent story is loaded and has no epic.
+			{Key: "TIKV-5", Fields: &jira.IssueFields{Type: jira.IssueType{Subtask: true}, Parent: &jira.Parent{Key: "TIKV-6"}}},
+		},
+	}
+	r := newMemReporter(t, m)
+	var errs reportErrors
+	w := &confluenceWriter{}
+	r.genWeeklyReportProjects(w, sprint, &errs)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, s := range []string{
+		`project = TIKV and parent = TIKV-1 and Sprint = 7`,
+		`<ul><li><a href="TIKV-2">TIKV-2</a> Story<ul><li><a href="TIKV-3">TIKV-3</a> Sub-task</li></ul>`,
+	} {
+		if !strings.Contains(w.String(), s) {
+			t.Errorf("expect projects to contain %q, got:\n%s", s, w.String())
+		}
+	}
+	if strings.Count(w.String(), "<tr>") != 2 {
+		t.Errorf("expect only one project, got:\n%s", w.String())
+	}
+	expect := "SearchJiraIssues project = TIKV AND Sprint = 7,GetIssue TIKV-6,GetIssue TIKV-1"
+	if calls := strings.Join(m.calls[1:], ","); calls != expect {
+		t.Errorf("expect calls %q, got %q", expect, calls)
+	}
+
+	// The configured fields are not discovered, and the values of the
+	// unexpected types are skipped.
+	m = &memServices{
+		jiraIssues: []jira.Issue{
+			{Key: "TIKV-2", Fields: &jira.IssueFields{Unknowns: map[string]interface{}{"cf_link": "TIKV-1"}}},
+			{Key: "TIKV-3", Fields: &jira.IssueFields{Unknowns: map[string]interface{}{"cf_link": 10001}}},
+			{Key: "TIKV-4"},
+		},
+	}
+	r = newMemReporter(t, m)
+	r.config.Jira.Fields = JiraFields{EpicLink: "cf_link", EpicName: "cf_name", Collaborators: "cf_users"}
+	errs = nil
+	w = &confluenceWriter{}
+	r.genWeeklyReportProjects(w, sprint, &errs)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for _, c := range m.calls {
+		if c == "GetFields" {
+			t.Errorf("expect the configured fields not to be discovered")
+		}
+	}
+	if !strings.Contains(w.String(), `cf_link = TIKV-1`) {
+		t.Errorf("expect the project of TIKV-1, got:\n%s", w.String())
+	}
+	if strings.Count(w.String(), "<tr>") != 2 {
+		t.Errorf("expect only one project, got:\n%s", w.String())
+	}
+}
+
+func TestJiraUsersField(t *testing.T) {
+	issue := &jira.Issue{Fields: &jira.IssueFields{Unknowns: map[string]interface{}{
+		"users": []interface{}{map[string]interface{}{"name": "bob"}, nil, "alice", map[string]interface{}{"name": 1}},
+		"text":  "not users",
+	}}}
+	if names := jiraUsersField(issue, "users"); len(names) != 1 || names[0] != "bob" {
+		t.Errorf("unexpected users %v", names)
+	}
+	if names := jiraUsersField(issue, "text"); names != nil {
+		t.Errorf("unexpected users %v", names)
+	}
+}
+
+func TestJiraFieldJQL(t *testing.T) {
+	tbl := []struct {
+		id     string
+		expect string
+	}{
+		{"customfield_10100", "cf[10100]"},
+		{"parent", "parent"},
+		{"", `"Epic Link"`},
+	}
+	for _, c := range tbl {
+		if got := jiraFieldJQL(c.id, jiraFieldEpicLink); got != c.expect {
+			t.Errorf("%q: expect %s, got %s", c.id, c.expect, got)
+		}
+	}
+}
+
+func TestJiraFieldsDiscoveryDoesNotBlockMentions(t *testing.T) {
+	m := &memServices{userIDs: map[string]string{"tl@pingcap.com": "U1"}}
+	r := newMemReporter(t, m)
+
+	entered, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	m.afterCall = func(c string) {
+		if c == "GetFields" {
+			close(entered)
+			<-release
+		}
+	}
+	go func() {
+		r.getJiraFields()
+		close(done)
+	}()
+	<-entered
+
+	mention := make(chan string, 1)
+	go func() { mention <- r.buildSlackMention("tl@pingcap.com") }()
+	select {
+	case s := <-mention:
+		if s != "<@U1>" {
+			t.Errorf("unexpected mention %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expect the mention not to wait on the field discovery")
+	}
+	close(release)
+	<-done
+}
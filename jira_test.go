@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestIterateJiraIssuesPages(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	// Jira caps the page size below the requested max results.
+	const total, pageSize = 5, 2
+	env.jira.handle("GET", "/rest/api/2/search", func(r *http.Request, body string) interface{} {
+		startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		var issues []map[string]interface{}
+		for i := startAt; i < total && i < startAt+pageSize; i++ {
+			issues = append(issues, map[string]interface{}{"key": fmt.Sprintf("TIKV-%d", i)})
+		}
+		result := jiraSearchResult(issues...)
+		result["startAt"] = startAt
+		result["maxResults"] = pageSize
+		result["total"] = total
+		return result
+	})
+
+	var keys []string
+	opts := jiraSearchOptions{Fields: []string{"summary", "status"}, Expand: "changelog"}
+	err := env.reporter.iterateJiraIssues("project = TIKV", opts, func(issue jira.Issue) error {
+		keys = append(keys, issue.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"TIKV-0", "TIKV-1", "TIKV-2", "TIKV-3", "TIKV-4"}
+	if !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("got %v, expect %v", keys, expect)
+	}
+
+	var starts []string
+	for _, req := range env.jira.requestsTo("GET", "/rest/api/2/search") {
+		form := parseForm(t, req.Query)
+		if form.Get("fields") != "summary,status" || form.Get("expand") != "changelog" {
+			t.Fatalf("unexpected query %s", req.Query)
+		}
+		starts = append(starts, form.Get("startAt"))
+	}
+	if expect := []string{"0", "2", "4"}; !reflect.DeepEqual(starts, expect) {
+		t.Fatalf("got start %v, expect %v", starts, expect)
+	}
+}
+
+func TestIterateJiraIssuesStops(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	env.jira.reply("GET", "/rest/api/2/search", map[string]interface{}{
+		"startAt":    0,
+		"maxResults": 2,
+		"total":      4,
+		"issues":     []map[string]interface{}{{"key": "TIKV-0"}, {"key": "TIKV-1"}},
+	})
+
+	stop := fmt.Errorf("stop")
+	var n int
+	err := env.reporter.iterateJiraIssues("project = TIKV", jiraSearchOptions{}, func(issue jira.Issue) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("got err %v after %d issues", err, n)
+	}
+	reqs := env.jira.requestsTo("GET", "/rest/api/2/search")
+	if len(reqs) != 1 || parseForm(t, reqs[0].Query).Get("fields") != "*navigable" {
+		t.Fatalf("unexpected requests %v", reqs)
+	}
+}
+
+func TestGetClosestSprints(t *testing.T) {
+	r := newMemReporter(t, &memServices{})
+	now := time.Now()
+	sprint := func(id int, start time.Duration, end time.Duration) jira.Sprint {
+		s, e := now.Add(start), now.Add(end)
+		return jira.Sprint{ID: id, Name: fmt.Sprintf("TIKV %d", id), StartDate: &s, EndDate: &e}
+	}
+	day := 24 * time.Hour
+
+	// The closest sprint wins, not the last one in the range.
+	passed := []jira.Sprint{sprint(1, -8*day, -day), sprint(2, -10*day, -3*day)}
+	if s := r.getLatestPassedSprint(passed); s == nil || s.ID != 1 {
+		t.Errorf("expect the latest passed sprint 1, got %+v", s)
+	}
+	future := []jira.Sprint{sprint(3, day, 8*day), sprint(4, 3*day, 10*day)}
+	if s := r.getNearestFutureSprint(future); s == nil || s.ID != 3 {
+		t.Errorf("expect the nearest future sprint 3, got %+v", s)
+	}
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
+	"time"
 
-	jira "github.com/andygrunwald/go-jira"
-	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
-	"golang.org/x/oauth2"
 )
 
 func perror(err error) {
@@ -27,13 +25,10 @@ func perrmsg(msg string) {
 }
 
 var (
-	token           string
-	configFile      string
-	globalCtx       context.Context
-	config          *Config
-	githubClient    *github.Client
-	jiraClient      *jira.Client
-	conflunceClient *jira.Client
+	configFile string
+	dryRun     bool
+	noCache    bool
+	timeout    time.Duration
 )
 
 func main() {
@@ -43,13 +38,19 @@ func main() {
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "C", "", "Config File, default ~/.work-reporter/config.toml")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the reports and changes to stdout instead of sending them to Slack, Confluence or Jira")
+
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Load everything from GitHub and Jira instead of the on-disk cache")
+
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Deadline of the command or of every scheduled job, default depends on the command")
 
 	rootCmd.AddCommand(
 		newDailyCommand(),
 		newWeeklyCommand(),
+		newTriageCommand(),
+		newServeCommand(),
 	)
 
-	cobra.OnInitialize(initGlobal)
 	cobra.EnablePrefixMatching = true
 
 	if err := rootCmd.Execute(); err != nil {
@@ -57,52 +58,45 @@ func main() {
 	}
 }
 
-func initGlobal() {
-	usr, err := user.Current()
-	perror(err)
-
+// newReporterFromFlags creates the Reporter with the config file and
+// the dry-run mode in the command line flags.
+func newReporterFromFlags() (*Reporter, error) {
 	if len(configFile) == 0 {
+		usr, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
 		configFile = path.Join(usr.HomeDir, ".work-reporter/config.toml")
 	}
 	cfg, err := NewConfigFromFile(configFile)
-	perror(err)
-
-	globalCtx = context.Background()
-	config = cfg
-
-	initRepoQuery()
-
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: cfg.Github.Token},
-	)
-
-	tc := oauth2.NewClient(globalCtx, ts)
-	githubClient = github.NewClient(tc)
-
-	initTeamMembers()
-
-	jiraTransport := jira.BasicAuthTransport{
-		Username: config.Jira.User,
-		Password: config.Jira.Password,
+	if err != nil {
+		return nil, err
 	}
-
-	jiraClient, err = jira.NewClient(jiraTransport.Client(), config.Jira.Endpoint)
-	perror(err)
-
-	// In our company, we use same user and password for Jira and Confluence.
-	if len(config.Confluence.User) == 0 {
-		config.Confluence.User = config.Jira.User
+	// The cache is next to the config file by default.
+	if len(cfg.Cache.Dir) == 0 {
+		cfg.Cache.Dir = filepath.Join(filepath.Dir(configFile), "cache")
 	}
-
-	if len(config.Confluence.Password) == 0 {
-		config.Confluence.Password = config.Jira.Password
+	cfg.Cache.Disable = cfg.Cache.Disable || noCache
+	// So is the rotation journal.
+	if len(cfg.Sprint.Journal) == 0 {
+		cfg.Sprint.Journal = filepath.Join(filepath.Dir(configFile), "rotate-journal.json")
 	}
 
-	// A little tricky here, both JIRA and Confluence use the same REST style.
-	confluenceTransport := jira.BasicAuthTransport{
-		Username: config.Confluence.User,
-		Password: config.Confluence.Password,
-	}
-	conflunceClient, err = jira.NewClient(confluenceTransport.Client(), config.Confluence.Endpoint)
+	return NewReporter(cfg, dryRun)
+}
+
+func mustNewReporter() *Reporter {
+	r, err := newReporterFromFlags()
+	perror(err)
+	return r
+}
+
+// runCommand runs f with a new Reporter until it returns, the deadline
+// passes or the process is interrupted.
+func runCommand(defaultTimeout time.Duration, f func(r *Reporter) error) {
+	r := mustNewReporter()
+	ctx, cancel := newSignalContext()
+	err := r.runWithTimeout(ctx, commandTimeout(defaultTimeout), func() error { return f(r) })
+	cancel()
 	perror(err)
 }
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/google/go-github/github"
+)
+
+// The output formats of the weekly report.
+const (
+	outputConfluence = "confluence"
+	outputMarkdown   = "markdown"
+	outputHTML       = "html"
+)
+
+const jiraLabelColorGrey = "Grey"
+const jiraLabelColorRed = "Red"
+const jiraLabelColorYellow = "Yellow"
+const jiraLabelColorGreen = "Green"
+const jiraLabelColorBlue = "Blue"
+
+// pageLabel is a colored status label.
+type pageLabel struct {
+	name  string
+	color string
+}
+
+// pageIssue is a GitHub issue or PR in the page. The repo label goes before
+// the link and the other labels go after it.
+type pageIssue struct {
+	repo      pageLabel
+	url       string
+	title     string
+	author    string
+	assignees []string
+	labels    []pageLabel
+}
+
+// pageStory is an issue of a project with its sub-tasks.
+type pageStory struct {
+	key      string
+	summary  string
+	status   string
+	subtasks []pageStory
+}
+
+// pageProject is a project, the epic, in the weekly report.
+type pageProject struct {
+	key           string
+	name          string
+	manager       string
+	collaborators []string
+	stories       []pageStory
+	// The JQL of the issues in the project.
+	jql string
+	// The epic failed to load.
+	err error
+}
+
+// pageWriter renders the pages of the weekly report in one output format.
+// All the texts are plain and escaped by the writer.
+type pageWriter interface {
+	beginPage(title string)
+	endPage()
+	beginSection()
+	endSection()
+	// toc writes the table of contents of the top level headings.
+	toc()
+	heading(level int, text string)
+	quote(text string)
+	paragraph(text string)
+	lineBreak()
+	// placeholder writes a box for the reader to fill in.
+	placeholder(desc string)
+	failure(err error)
+	issues(issues []pageIssue)
+	// jiraIssues writes the Jira issues matching the JQL in the columns.
+	jiraIssues(columns []string, jql string)
+	projects(projects []pageProject)
+	String() string
+}
+
+// newPageWriter returns the writer of the output format. The writers other
+// than Confluence expand the Jira issues by running the JQL, and collect
+// the failures into errs.
+func (r *Reporter) newPageWriter(output string, errs *reportErrors) (pageWriter, error) {
+	switch output {
+	case outputConfluence, "":
+		return &confluenceWriter{
+			jira:      r.config.Jira,
+			snapshot:  r.config.Confluence.JiraSnapshot,
+			jiraTable: r.newJiraTable(errs),
+			now:       time.Now(),
+		}, nil
+	case outputMarkdown:
+		return &markdownWriter{jiraTable: r.newJiraTable(errs)}, nil
+	case outputHTML:
+		return &htmlWriter{jiraTable: r.newJiraTable(errs)}, nil
+	}
+	return nil, fmt.Errorf("unknown output %q, must be %s, %s or %s", output, outputConfluence, outputMarkdown, outputHTML)
+}
+
+func (r *Reporter) newPageIssue(issue github.Issue) pageIssue {
+	p := pageIssue{
+		repo:   pageLabel{issueRepoName(issue), jiraLabelColorGrey},
+		url:    issue.GetHTMLURL(),
+		title:  issue.GetTitle(),
+		author: issue.GetUser().GetLogin(),
+	}
+	if issue.GetState() == "closed" {
+		p.repo.color = jiraLabelColorGreen
+	}
+	for _, assignee := range issue.Assignees {
+		p.assignees = append(p.assignees, assignee.GetLogin())
+	}
+	if !r.isTeamMember(issue.GetUser().GetLogin()) {
+		p.labels = append(p.labels, pageLabel{"Community", jiraLabelColorBlue})
+	}
+	return p
+}
+
+func (r *Reporter) newPageIssues(issues []github.Issue) []pageIssue {
+	items := make([]pageIssue, 0, len(issues))
+	for _, issue := range issues {
+		items = append(items, r.newPageIssue(issue))
+	}
+	return items
+}
+
+// jiraTable queries the Jira issues to expand the JQL into tables.
+type jiraTable struct {
+	query func(jql string) ([]jira.Issue, error)
+	// The URL prefix to browse an issue.
+	browse string
+	errs   *reportErrors
+}
+
+func (r *Reporter) newJiraTable(errs *reportErrors) jiraTable {
+	return jiraTable{
+		query:  r.queryJiraIssues,
+		browse: strings.TrimSuffix(r.config.Jira.Endpoint, "/") + "/browse/",
+		errs:   errs,
+	}
+}
+
+// load returns the rows of the issues matching the JQL in the columns.
+func (t jiraTable) load(columns []string, jql string) ([][]string, error) {
+	issues, err := t.query(jql)
+	if err != nil {
+		t.errs.add("JQL "+jql, err)
+		return nil, err
+	}
+	rows := make([][]string, 0, len(issues))
+	for _, issue := range issues {
+		row := make([]string, 0, len(columns))
+		for _, column := range columns {
+			row = append(row, jiraIssueColumn(issue, column))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func jiraIssueColumn(issue jira.Issue, column string) string {
+	fields := issue.Fields
+	if fields == nil {
+		fields = &jira.IssueFields{}
+	}
+	switch column {
+	case "key":
+		return issue.Key
+	case "summary":
+		return fields.Summary
+	case "status":
+		if fields.Status != nil {
+			return fields.Status.Name
+		}
+	case "assignee":
+		if fields.Assignee != nil {
+			if len(fields.Assignee.DisplayName) > 0 {
+				return fields.Assignee.DisplayName
+			}
+			return fields.Assignee.Name
+		}
+	case "created":
+		return formatJiraTime(fields.Created)
+	case "updated":
+		return formatJiraTime(fields.Updated)
+	}
+	return ""
+}
+
+func formatJiraTime(t jira.Time) string {
+	tm := time.Time(t)
+	if tm.IsZero() {
+		return ""
+	}
+	return tm.Format(dayFormat)
+}
+
+// jiraColumnTitle returns the column name in the table header.
+func jiraColumnTitle(column string) string {
+	if len(column) == 0 {
+		return column
+	}
+	return strings.ToUpper(column[:1]) + column[1:]
+}
+
+// snapshotColumns are the columns of the static Jira issue tables.
+var snapshotColumns = []string{"key", "summary", "assignee", "status", "created", "updated"}
+
+// confluenceWriter writes the Confluence storage format, with the Jira
+// macros showing the live issues, or the static tables of the issues at
+// the generation time if snapshot is set.
+type confluenceWriter struct {
+	buf       bytes.Buffer
+	jira      Jira
+	snapshot  string
+	jiraTable jiraTable
+	now       time.Time
+}
+
+func (w *confluenceWriter) String() string {
+	return w.buf.String()
+}
+
+// The title is the title of the Confluence page, not in the body.
+func (w *confluenceWriter) beginPage(title string) {
+	w.buf.WriteString(`<ac:layout>`)
+}
+
+func (w *confluenceWriter) endPage() {
+	w.buf.WriteString(`</ac:layout>`)
+}
+
+func (w *confluenceWriter) beginSection() {
+	w.buf.WriteString(`<ac:layout-section ac:type="single"><ac:layout-cell><hr/>`)
+	w.buf.WriteString("\n")
+}
+
+func (w *confluenceWriter) endSection() {
+	w.buf.WriteString(`</ac:layout-cell></ac:layout-section>`)
+	w.buf.WriteString("\n")
+}
+
+func (w *confluenceWriter) toc() {
+	toc := `
+<ac:structured-macro ac:name="toc">
+  <ac:parameter ac:name="printable">true</ac:parameter>
+  <ac:parameter ac:name="style">square</ac:parameter>
+  <ac:parameter ac:name="maxLevel">2</ac:parameter>
+  <ac:parameter ac:name="class">bigpink</ac:parameter>
+  <ac:parameter ac:name="type">list</ac:parameter>
+</ac:structured-macro>
+	`
+	w.buf.WriteString(toc)
+}
+
+func (w *confluenceWriter) heading(level int, text string) {
+	w.buf.WriteString(fmt.Sprintf("\n<h%d>%s</h%d>\n", level, html.EscapeString(text), level))
+}
+
+func (w *confluenceWriter) quote(text string) {
+	w.buf.WriteString(fmt.Sprintf("\n<blockquote>%s</blockquote>\n", html.EscapeString(text)))
+}
+
+func (w *confluenceWriter) paragraph(text string) {
+	w.buf.WriteString(fmt.Sprintf("\n<p>%s</p>\n", html.EscapeString(text)))
+}
+
+func (w *confluenceWriter) lineBreak() {
+	w.buf.WriteString("\n<br />")
+}
+
+func genPanelPlaceholder(buf *bytes.Buffer, desc string) {
+	panelTemplate := `
+    <ac:structured-macro ac:name="panel">
+    <ac:rich-text-body>
+      <p><ac:placeholder>%s</ac:placeholder></p>
+    </ac:rich-text-body>
+    </ac:structured-macro>`
+	buf.WriteString(fmt.Sprintf(panelTemplate, desc))
+}
+
+func (w *confluenceWriter) placeholder(desc string) {
+	genPanelPlaceholder(&w.buf, html.EscapeString(desc))
+}
+
+func formatFailureForHtmlOutput(buf *bytes.Buffer, err error) {
+	buf.WriteString(fmt.Sprintf("<p><i>failed to load: %s</i></p>\n", html.EscapeString(err.Error())))
+}
+
+func (w *confluenceWriter) failure(err error) {
+	formatFailureForHtmlOutput(&w.buf, err)
+}
+
+func formatLabelForHtmlOutput(name string, color string) string {
+	s := fmt.Sprintf(`
+	<ac:structured-macro ac:macro-id="9f29312a-2730-48f0-ab6d-91d6bef3f016" ac:name="status" ac:schema-version="1">
+		<ac:parameter ac:name="colour">%s</ac:parameter>
+		<ac:parameter ac:name="title">%s</ac:parameter>
+	</ac:structured-macro>`, color, html.EscapeString(name))
+	return s
+}
+
+// formatIssueForHtmlOutput formats the issue with the label function, the
+// Confluence status macros or the HTML spans.
+func formatIssueForHtmlOutput(issue pageIssue, label func(pageLabel) string) string {
+	s := fmt.Sprintf(
+		`%s <a href="%s">%s</a> by @%s`,
+		label(issue.repo),
+		html.EscapeString(issue.url),
+		html.EscapeString(issue.title),
+		html.EscapeString(issue.author),
+	)
+
+	if len(issue.assignees) > 0 {
+		s += fmt.Sprintf(", assigned to")
+		for _, assignee := range issue.assignees {
+			s += fmt.Sprintf(" @%s", html.EscapeString(assignee))
+		}
+	}
+
+	for _, l := range issue.labels {
+		s += " " + label(l)
+	}
+	return s
+}
+
+func formatIssuesForHtmlOutput(buf *bytes.Buffer, issues []pageIssue, label func(pageLabel) string) {
+	if len(issues) == 0 {
+		buf.WriteString("<p><i>None</i></p>\n")
+		return
+	}
+	buf.WriteString("<ul>")
+	for _, issue := range issues {
+		buf.WriteString(fmt.Sprintf("<li>%s</li>\n", formatIssueForHtmlOutput(issue, label)))
+	}
+	buf.WriteString("</ul>")
+}
+
+// formatStoriesForHtmlOutput formats the stories with the sub-tasks in
+// nested lists.
+func formatStoriesForHtmlOutput(buf *bytes.Buffer, browse string, stories []pageStory) {
+	if len(stories) == 0 {
+		return
+	}
+	buf.WriteString("<ul>")
+	for _, story := range stories {
+		buf.WriteString(fmt.Sprintf(`<li><a href="%s%s">%s</a> %s`,
+			html.EscapeString(browse), html.EscapeString(story.key), html.EscapeString(story.key), html.EscapeString(story.summary)))
+		if len(story.status) > 0 {
+			buf.WriteString(fmt.Sprintf(" (%s)", html.EscapeString(story.status)))
+		}
+		formatStoriesForHtmlOutput(buf, browse, story.subtasks)
+		buf.WriteString("</li>")
+	}
+	buf.WriteString("</ul>\n")
+}
+
+func (w *confluenceWriter) issues(issues []pageIssue) {
+	formatIssuesForHtmlOutput(&w.buf, issues, func(l pageLabel) string {
+		return formatLabelForHtmlOutput(l.name, l.color)
+	})
+}
+
+func (w *confluenceWriter) jiraMacro(columns []string, jql string) string {
+	template := `
+<ac:structured-macro ac:name="jira">
+  <ac:parameter ac:name="columns">%s</ac:parameter>
+  <ac:parameter ac:name="server">%s</ac:parameter>
+  <ac:parameter ac:name="serverId">%s</ac:parameter>
+  <ac:parameter ac:name="jqlQuery">%s</ac:parameter>
+</ac:structured-macro>
+`
+	return fmt.Sprintf(template, strings.Join(columns, ","), w.jira.Server, w.jira.ServerID, html.EscapeString(jql))
+}
+
+// jiraSnapshot returns the static table of the issues matching the JQL.
+func (w *confluenceWriter) jiraSnapshot(jql string) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("\n<p><i>Snapshot as of %s</i></p>\n", w.now.Format("2006-01-02 15:04 MST")))
+	rows, err := w.jiraTable.load(snapshotColumns, jql)
+	if err != nil {
+		formatFailureForHtmlOutput(&buf, err)
+	} else {
+		formatJiraTableForHtmlOutput(&buf, w.jiraTable.browse, snapshotColumns, rows)
+	}
+	return buf.String()
+}
+
+// jiraIssuesValue returns the live macro or the snapshot, or both.
+func (w *confluenceWriter) jiraIssuesValue(columns []string, jql string) string {
+	switch w.snapshot {
+	case jiraSnapshotStatic:
+		return w.jiraSnapshot(jql)
+	case jiraSnapshotBoth:
+		return w.jiraSnapshot(jql) + w.jiraMacro(columns, jql)
+	}
+	return w.jiraMacro(columns, jql)
+}
+
+func (w *confluenceWriter) jiraIssues(columns []string, jql string) {
+	w.buf.WriteString(w.jiraIssuesValue(columns, jql))
+}
+
+func (w *confluenceWriter) projects(projects []pageProject) {
+	table := `
+  <table class="relative-table wrapped">
+    <tbody>
+    <tr>
+      <th>Name</th>
+      <th>Manager(*) &amp; Collaborators</th>
+      <th><p>Description</p></th>
+      <th><p>Links</p></th>
+    </tr>
+    %s
+    </tbody>
+  </table>`
+
+	rowTemplate := `
+    <tr>
+      <td>%s</td>
+      <td>%s</td>
+      <td>%s</td>
+      <td>
+        <ac:structured-macro ac:name="expand">
+        <ac:parameter ac:name="title">Issues</ac:parameter>
+        <ac:rich-text-body>
+        %s
+        </ac:rich-text-body>
+        </ac:structured-macro>
+      </td>
+    </tr>`
+
+	descHolderBuf := bytes.Buffer{}
+	genPanelPlaceholder(&descHolderBuf, "Please describe your update here")
+
+	rowsBuf := bytes.Buffer{}
+	for _, p := range projects {
+		storiesBuf := bytes.Buffer{}
+		formatStoriesForHtmlOutput(&storiesBuf, w.jiraTable.browse, p.stories)
+		issues := storiesBuf.String() + w.jiraIssuesValue([]string{"key", "summary", "assignee", "created", "updated", "status"}, p.jql)
+		if p.err != nil {
+			failureBuf := bytes.Buffer{}
+			formatFailureForHtmlOutput(&failureBuf, p.err)
+			rowsBuf.WriteString(fmt.Sprintf(rowTemplate, html.EscapeString(p.key), "", failureBuf.String(), issues))
+			continue
+		}
+
+		userTemplate := `<ac:link><ri:user ri:username="%s" /></ac:link>`
+		participantsBuf := bytes.Buffer{}
+		participantsBuf.WriteString(fmt.Sprintf(userTemplate, html.EscapeString(p.manager)) + "*")
+		for _, name := range p.collaborators {
+			participantsBuf.WriteString("<br />")
+			participantsBuf.WriteString(fmt.Sprintf(userTemplate, html.EscapeString(name)))
+		}
+		rowsBuf.WriteString(fmt.Sprintf(rowTemplate, html.EscapeString(p.name), participantsBuf.String(), descHolderBuf.String(), issues))
+	}
+
+	w.buf.WriteString(fmt.Sprintf(table, rowsBuf.String()))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The style of the standalone HTML page, the label colors follow the
+// Confluence status macro.
+const htmlPageStyle = `
+body { font-family: sans-serif; max-width: 1100px; margin: 0 auto; padding: 0 16px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+blockquote { color: #666; border-left: 3px solid #ccc; margin-left: 0; padding-left: 12px; }
+.label { font-size: 75%; font-weight: bold; padding: 1px 4px; border-radius: 3px; text-transform: uppercase; }
+.label-grey { background: #dfe1e6; }
+.label-red { background: #de350b; color: #fff; }
+.label-yellow { background: #ffc400; }
+.label-green { background: #00875a; color: #fff; }
+.label-blue { background: #0052cc; color: #fff; }
+.placeholder { border: 1px dashed #ccc; color: #999; padding: 8px; }
+`
+
+// htmlWriter writes a standalone HTML page, the Jira issues are expanded
+// into tables.
+type htmlWriter struct {
+	buf       bytes.Buffer
+	jiraTable jiraTable
+	headings  []string
+}
+
+func (w *htmlWriter) String() string {
+	var toc bytes.Buffer
+	toc.WriteString("<ul>\n")
+	for _, h := range w.headings {
+		toc.WriteString(fmt.Sprintf("<li><a href=\"#%s\">%s</a></li>\n", headingAnchor(h), html.EscapeString(h)))
+	}
+	toc.WriteString("</ul>\n")
+	return strings.Replace(w.buf.String(), pageTocMarker, toc.String(), 1)
+}
+
+func (w *htmlWriter) beginPage(title string) {
+	w.buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	w.buf.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(title)))
+	w.buf.WriteString(fmt.Sprintf("<style>%s</style>\n", htmlPageStyle))
+	w.buf.WriteString(fmt.Sprintf("</head>\n<body>\n<h1>%s</h1>\n", html.EscapeString(title)))
+}
+
+func (w *htmlWriter) endPage() {
+	w.buf.WriteString("</body>\n</html>\n")
+}
+
+func (w *htmlWriter) beginSection() {
+	w.buf.WriteString("<section>\n<hr/>\n")
+}
+
+func (w *htmlWriter) endSection() {
+	w.buf.WriteString("</section>\n")
+}
+
+func (w *htmlWriter) toc() {
+	w.buf.WriteString(pageTocMarker)
+}
+
+func (w *htmlWriter) heading(level int, text string) {
+	if level == 1 {
+		w.headings = append(w.headings, text)
+	}
+	w.buf.WriteString(fmt.Sprintf("<h%d id=\"%s\">%s</h%d>\n", level, headingAnchor(text), html.EscapeString(text), level))
+}
+
+func (w *htmlWriter) quote(text string) {
+	w.buf.WriteString(fmt.Sprintf("<blockquote>%s</blockquote>\n", html.EscapeString(text)))
+}
+
+func (w *htmlWriter) paragraph(text string) {
+	w.buf.WriteString(fmt.Sprintf("<p>%s</p>\n", html.EscapeString(text)))
+}
+
+func (w *htmlWriter) lineBreak() {
+	w.buf.WriteString("<br />\n")
+}
+
+func (w *htmlWriter) placeholder(desc string) {
+	w.buf.WriteString(fmt.Sprintf("<div class=\"placeholder\">%s</div>\n", html.EscapeString(desc)))
+}
+
+func (w *htmlWriter) failure(err error) {
+	formatFailureForHtmlOutput(&w.buf, err)
+}
+
+func formatLabelForStandaloneHtmlOutput(l pageLabel) string {
+	return fmt.Sprintf(`<span class="label label-%s">%s</span>`, strings.ToLower(l.color), html.EscapeString(l.name))
+}
+
+func (w *htmlWriter) issues(issues []pageIssue) {
+	formatIssuesForHtmlOutput(&w.buf, issues, formatLabelForStandaloneHtmlOutput)
+	w.buf.WriteString("\n")
+}
+
+// formatJiraTableForHtmlOutput formats the rows of the Jira issues in a
+// table, the key links to the issue.
+func formatJiraTableForHtmlOutput(buf *bytes.Buffer, browse string, columns []string, rows [][]string) {
+	if len(rows) == 0 {
+		buf.WriteString("<p><i>None</i></p>\n")
+		return
+	}
+	buf.WriteString("<table>\n<tr>")
+	for _, column := range columns {
+		buf.WriteString(fmt.Sprintf("<th>%s</th>", jiraColumnTitle(column)))
+	}
+	buf.WriteString("</tr>\n")
+	for _, row := range rows {
+		buf.WriteString("<tr>")
+		for i, column := range columns {
+			if column == "key" {
+				buf.WriteString(fmt.Sprintf(`<td><a href="%s%s">%s</a></td>`,
+					html.EscapeString(browse), html.EscapeString(row[i]), html.EscapeString(row[i])))
+			} else {
+				buf.WriteString(fmt.Sprintf("<td>%s</td>", html.EscapeString(row[i])))
+			}
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</table>\n")
+}
+
+func (w *htmlWriter) jiraIssues(columns []string, jql string) {
+	rows, err := w.jiraTable.load(columns, jql)
+	if err != nil {
+		w.failure(err)
+		return
+	}
+	formatJiraTableForHtmlOutput(&w.buf, w.jiraTable.browse, columns, rows)
+}
+
+func (w *htmlWriter) projects(projects []pageProject) {
+	w.buf.WriteString("<table>\n<tr><th>Name</th><th>Manager(*) &amp; Collaborators</th><th>Description</th><th>Issues</th></tr>\n")
+	for _, p := range projects {
+		w.buf.WriteString("<tr>")
+		if p.err != nil {
+			w.buf.WriteString(fmt.Sprintf("<td>%s</td><td></td><td>", html.EscapeString(p.key)))
+			w.failure(p.err)
+		} else {
+			participants := html.EscapeString(p.manager) + "*"
+			for _, name := range p.collaborators {
+				participants += "<br />" + html.EscapeString(name)
+			}
+			w.buf.WriteString(fmt.Sprintf("<td>%s</td><td>%s</td><td>", html.EscapeString(p.name), participants))
+			w.placeholder("Please describe your update here")
+		}
+		w.buf.WriteString("</td><td>")
+		formatStoriesForHtmlOutput(&w.buf, w.jiraTable.browse, p.stories)
+		w.jiraIssues([]string{"key", "summary", "assignee", "created", "updated", "status"}, p.jql)
+		w.buf.WriteString("</td></tr>\n")
+	}
+	w.buf.WriteString("</table>\n")
+}
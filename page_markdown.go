@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The marker replaced with the table of contents when all the headings
+// are written.
+const pageTocMarker = "\x00toc\x00"
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", "&lt;", ">", "&gt;", "|", `\|`, "#", `\#`,
+)
+
+// markdownEscape escapes the text in a Markdown paragraph or table cell.
+func markdownEscape(text string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(text), " "))
+}
+
+var regexAnchor = regexp.MustCompile(`[^\w\- ]`)
+
+// headingAnchor returns the anchor of the heading the way GitHub does.
+func headingAnchor(text string) string {
+	anchor := regexAnchor.ReplaceAllString(strings.ToLower(text), "")
+	return strings.Replace(anchor, " ", "-", -1)
+}
+
+// markdownWriter writes GitHub flavored Markdown, the Jira issues are
+// expanded into tables.
+type markdownWriter struct {
+	buf       bytes.Buffer
+	jiraTable jiraTable
+	headings  []string
+}
+
+func (w *markdownWriter) String() string {
+	var toc bytes.Buffer
+	for _, h := range w.headings {
+		toc.WriteString(fmt.Sprintf("- [%s](#%s)\n", markdownEscape(h), headingAnchor(h)))
+	}
+	return strings.Replace(w.buf.String(), pageTocMarker, toc.String(), 1)
+}
+
+func (w *markdownWriter) beginPage(title string) {
+	w.buf.WriteString(fmt.Sprintf("# %s\n\n", markdownEscape(title)))
+}
+
+func (w *markdownWriter) endPage() {}
+
+func (w *markdownWriter) beginSection() {}
+
+func (w *markdownWriter) endSection() {
+	w.buf.WriteString("\n---\n\n")
+}
+
+func (w *markdownWriter) toc() {
+	w.buf.WriteString(pageTocMarker)
+}
+
+func (w *markdownWriter) heading(level int, text string) {
+	if level == 1 {
+		w.headings = append(w.headings, text)
+	}
+	w.buf.WriteString(fmt.Sprintf("%s %s\n\n", strings.Repeat("#", level), markdownEscape(text)))
+}
+
+func (w *markdownWriter) quote(text string) {
+	w.buf.WriteString(fmt.Sprintf("> %s\n\n", markdownEscape(text)))
+}
+
+func (w *markdownWriter) paragraph(text string) {
+	w.buf.WriteString(fmt.Sprintf("%s\n\n", markdownEscape(text)))
+}
+
+func (w *markdownWriter) lineBreak() {
+	w.buf.WriteString("\n")
+}
+
+func (w *markdownWriter) placeholder(desc string) {
+	w.buf.WriteString(fmt.Sprintf("_%s_\n\n", markdownEscape(desc)))
+}
+
+func (w *markdownWriter) failure(err error) {
+	w.buf.WriteString(fmt.Sprintf("_failed to load: %s_\n\n", markdownEscape(err.Error())))
+}
+
+func formatIssueForMarkdownOutput(issue pageIssue) string {
+	s := fmt.Sprintf("`%s` [%s](%s) by @%s",
+		issue.repo.name, markdownEscape(issue.title), issue.url, markdownEscape(issue.author))
+	if len(issue.assignees) > 0 {
+		s += ", assigned to"
+		for _, assignee := range issue.assignees {
+			s += " @" + markdownEscape(assignee)
+		}
+	}
+	for _, l := range issue.labels {
+		s += fmt.Sprintf(" `%s`", l.name)
+	}
+	return s
+}
+
+func (w *markdownWriter) issues(issues []pageIssue) {
+	if len(issues) == 0 {
+		w.buf.WriteString("_None_\n\n")
+		return
+	}
+	for _, issue := range issues {
+		w.buf.WriteString(fmt.Sprintf("- %s\n", formatIssueForMarkdownOutput(issue)))
+	}
+	w.buf.WriteString("\n")
+}
+
+func (w *markdownWriter) table(header []string, rows [][]string) {
+	w.buf.WriteString("| " + strings.Join(header, " | ") + " |\n")
+	w.buf.WriteString(strings.Repeat("| --- ", len(header)) + "|\n")
+	for _, row := range rows {
+		w.buf.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	w.buf.WriteString("\n")
+}
+
+func (w *markdownWriter) jiraIssues(columns []string, jql string) {
+	rows, err := w.jiraTable.load(columns, jql)
+	if err != nil {
+		w.failure(err)
+		return
+	}
+	if len(rows) == 0 {
+		w.buf.WriteString("_None_\n\n")
+		return
+	}
+
+	header := make([]string, 0, len(columns))
+	for _, column := range columns {
+		header = append(header, jiraColumnTitle(column))
+	}
+	for _, row := range rows {
+		for i, column := range columns {
+			if column == "key" {
+				row[i] = fmt.Sprintf("[%s](%s%s)", row[i], w.jiraTable.browse, row[i])
+			} else {
+				row[i] = markdownEscape(row[i])
+			}
+		}
+	}
+	w.table(header, rows)
+}
+
+// Markdown tables can not hold the issue tables, so every project is a
+// sub section.
+func (w *markdownWriter) projects(projects []pageProject) {
+	if len(projects) == 0 {
+		w.buf.WriteString("_None_\n\n")
+		return
+	}
+	for _, p := range projects {
+		if p.err != nil {
+			w.heading(2, p.key)
+			w.failure(p.err)
+		} else {
+			w.heading(2, p.name)
+			participants := "@" + markdownEscape(p.manager) + "\\*"
+			for _, name := range p.collaborators {
+				participants += ", @" + markdownEscape(name)
+			}
+			w.buf.WriteString(fmt.Sprintf("Manager(\\*) & Collaborators: %s\n\n", participants))
+			w.placeholder("Please describe your update here")
+		}
+		w.stories(p.stories, 0)
+		if len(p.stories) > 0 {
+			w.buf.WriteString("\n")
+		}
+		w.jiraIssues([]string{"key", "summary", "assignee", "created", "updated", "status"}, p.jql)
+	}
+}
+
+// stories writes the stories with the sub-tasks in nested lists.
+func (w *markdownWriter) stories(stories []pageStory, depth int) {
+	for _, story := range stories {
+		s := fmt.Sprintf("%s- [%s](%s%s) %s", strings.Repeat("  ", depth),
+			story.key, w.jiraTable.browse, story.key, markdownEscape(story.summary))
+		if len(story.status) > 0 {
+			s += fmt.Sprintf(" (%s)", markdownEscape(story.status))
+		}
+		w.buf.WriteString(s + "\n")
+		w.stories(story.subtasks, depth+1)
+	}
+}
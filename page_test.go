@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func newTestJiraTable(errs *reportErrors) jiraTable {
+	created := jira.Time(time.Date(2018, 10, 1, 8, 0, 0, 0, time.UTC))
+	return jiraTable{
+		query: func(jql string) ([]jira.Issue, error) {
+			if jql == "broken" {
+				return nil, errors.New("boom")
+			}
+			return []jira.Issue{{
+				Key: "TIKV-1",
+				Fields: &jira.IssueFields{
+					Summary:  "Fix a | b",
+					Status:   &jira.Status{Name: "Open"},
+					Assignee: &jira.User{Name: "tl", DisplayName: "Siddon Tang"},
+					Created:  created,
+				},
+			}}, nil
+		},
+		browse: "https://jira/browse/",
+		errs:   errs,
+	}
+}
+
+func writeTestPage(w pageWriter) {
+	w.beginPage("TIKV 2018-09-28 - 2018-10-04")
+	w.beginSection()
+	w.toc()
+	w.endSection()
+	w.beginSection()
+	w.heading(1, "New Issues")
+	w.issues([]pageIssue{{
+		repo:      pageLabel{"tikv/tikv", jiraLabelColorGrey},
+		url:       "https://github.com/tikv/tikv/issues/1",
+		title:     "Panic on <start>",
+		author:    "alice",
+		assignees: []string{"bob"},
+		labels:    []pageLabel{{"Community", jiraLabelColorBlue}},
+	}})
+	w.heading(1, "OnCall")
+	w.jiraIssues([]string{"key", "summary", "assignee", "created", "status"}, "project = OC")
+	w.jiraIssues([]string{"key"}, "broken")
+	w.endSection()
+	w.endPage()
+}
+
+func TestMarkdownWriter(t *testing.T) {
+	var errs reportErrors
+	w := &markdownWriter{jiraTable: newTestJiraTable(&errs)}
+	writeTestPage(w)
+	out := w.String()
+
+	for _, s := range []string{
+		"# TIKV 2018-09-28 - 2018-10-04\n\n",
+		"- [New Issues](#new-issues)\n- [OnCall](#oncall)\n",
+		"- `tikv/tikv` [Panic on &lt;start&gt;](https://github.com/tikv/tikv/issues/1) by @alice, assigned to @bob `Community`\n",
+		"| Key | Summary | Assignee | Created | Status |\n| --- | --- | --- | --- | --- |\n",
+		"| [TIKV-1](https://jira/browse/TIKV-1) | Fix a \\| b | Siddon Tang | 2018-10-01 | Open |\n",
+		"_failed to load: boom_\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expect markdown to contain %q, got:\n%s", s, out)
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "JQL broken: boom") {
+		t.Errorf("expect the failed JQL to be collected, got %v", errs)
+	}
+}
+
+func TestHTMLWriter(t *testing.T) {
+	var errs reportErrors
+	w := &htmlWriter{jiraTable: newTestJiraTable(&errs)}
+	writeTestPage(w)
+	out := w.String()
+
+	for _, s := range []string{
+		"<title>TIKV 2018-09-28 - 2018-10-04</title>",
+		`<li><a href="#new-issues">New Issues</a></li>`,
+		`<h1 id="new-issues">New Issues</h1>`,
+		`<span class="label label-grey">tikv/tikv</span> <a href="https://github.com/tikv/tikv/issues/1">Panic on &lt;start&gt;</a> by @alice`,
+		`<td><a href="https://jira/browse/TIKV-1">TIKV-1</a></td><td>Fix a | b</td><td>Siddon Tang</td><td>2018-10-01</td><td>Open</td>`,
+		"</body>\n</html>\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expect html to contain %q, got:\n%s", s, out)
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("expect the failed JQL to be collected, got %v", errs)
+	}
+}
+
+func TestConfluenceWriterSnapshot(t *testing.T) {
+	now := time.Date(2018, 10, 5, 8, 0, 0, 0, time.UTC)
+	row := `<td><a href="https://jira/browse/TIKV-1">TIKV-1</a></td><td>Fix a | b</td><td>Siddon Tang</td><td>Open</td><td>2018-10-01</td><td></td>`
+
+	tbl := []struct {
+		snapshot string
+		table    bool
+		macro    bool
+	}{
+		{"", false, true},
+		{jiraSnapshotStatic, true, false},
+		{jiraSnapshotBoth, true, true},
+	}
+	for _, tt := range tbl {
+		var errs reportErrors
+		w := &confluenceWriter{snapshot: tt.snapshot, jiraTable: newTestJiraTable(&errs), now: now}
+		w.jiraIssues([]string{"key", "summary"}, "project = OC")
+		out := w.String()
+
+		if strings.Contains(out, "Snapshot as of 2018-10-05 08:00 UTC") != tt.table || strings.Contains(out, row) != tt.table {
+			t.Errorf("snapshot %q: expect table %v, got:\n%s", tt.snapshot, tt.table, out)
+		}
+		if strings.Contains(out, `<ac:parameter ac:name="jqlQuery">project = OC</ac:parameter>`) != tt.macro {
+			t.Errorf("snapshot %q: expect macro %v, got:\n%s", tt.snapshot, tt.macro, out)
+		}
+	}
+}
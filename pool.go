@@ -0,0 +1,37 @@
+package main
+
+import "sync"
+
+// runParallel calls f with every index in [0, n), at most the configured
+// concurrency of them at the same time, and returns when all are done.
+// f saves its result by the index, so the report is assembled in order
+// whatever order the results are fetched in.
+func (r *Reporter) runParallel(n int, f func(i int)) {
+	limit := r.config.Concurrency
+	if limit > n {
+		limit = n
+	}
+	if limit <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, limit := range []int{0, 1, 3} {
+		r := &Reporter{config: &Config{Concurrency: limit}}
+
+		var (
+			mu            sync.Mutex
+			running, peak int
+		)
+		done := make([]bool, 10)
+		r.runParallel(len(done), func(i int) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+			done[i] = true
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+
+		for i, ok := range done {
+			if !ok {
+				t.Fatalf("limit %d: index %d is not called", limit, i)
+			}
+		}
+		if expect := limit; peak > expect && peak > 1 {
+			t.Fatalf("limit %d: got %d calls at the same time", limit, peak)
+		}
+	}
+}
+
+func TestDailyReportParallel(t *testing.T) {
+	env := newFakeEnv(t)
+	defer env.close()
+
+	env.github.handle("GET", "/search/issues", func(r *http.Request, body string) interface{} {
+		// Reply the later sections sooner.
+		if strings.Contains(r.URL.Query().Get("q"), "is:issue") {
+			time.Sleep(10 * time.Millisecond)
+			return githubSearchResult(githubIssue(1, "issues", "Issue one", "siddontang"))
+		}
+		return githubSearchResult(githubIssue(2, "pull", "PR two", "alice"))
+	})
+	env.jira.handle("GET", "/rest/api/2/search", func(r *http.Request, body string) interface{} {
+		return jiraSearchResult(map[string]interface{}{
+			"key":    "OC-1",
+			"fields": map[string]interface{}{"summary": fmt.Sprintf("OnCall of %s", r.URL.Query().Get("jql"))},
+		})
+	})
+
+	for _, concurrency := range []int{1, 4} {
+		env.reporter.config.Concurrency = concurrency
+		if err := env.reporter.runDailyReport(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs := env.slackMessages()
+	if len(msgs) != 2 || msgs[0] != msgs[1] {
+		t.Fatalf("expect the same reports, got %q", msgs)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/google/go-github/github"
+)
+
+// IssueSource searches and assigns the issues and pull requests on GitHub.
+type IssueSource interface {
+	// SearchIssues returns all the issues matching the query, sorted by the field,
+	// and whether the results are truncated by the 1000 results limit.
+	SearchIssues(query string, sort string) ([]github.Issue, bool, error)
+	// AddAssignees assigns the issue or PR in the repo "owner/name" to the users.
+	AddAssignees(repo string, number int, assignees []string) error
+	// ListPullRequestFiles returns the paths of the files changed by the PR.
+	ListPullRequestFiles(repo string, number int) ([]string, error)
+	// ListReviews returns all the reviews submitted to the PR.
+	ListReviews(repo string, number int) ([]github.PullRequestReview, error)
+}
+
+// IssueTracker queries the issues in Jira.
+type IssueTracker interface {
+	// SearchIssues calls f with every issue matching the JQL page by page,
+	// and stops at the first error returned by f.
+	SearchIssues(jql string, opts jiraSearchOptions, f func(jira.Issue) error) error
+	GetIssue(key string) (*jira.Issue, error)
+	// GetFields returns all the system and custom fields.
+	GetFields() ([]jira.Field, error)
+}
+
+// SprintManager manages the sprints of the Jira boards.
+type SprintManager interface {
+	// GetBoardID returns the first board ID of the project with the type.
+	GetBoardID(project string, boardType string) (int, error)
+	// GetSprints returns the sprints of the board in the state, all the
+	// sprints are returned if the state is empty.
+	GetSprints(boardID int, state string) ([]jira.Sprint, error)
+	CreateSprint(boardID int, name string, startDate, endDate string) (jira.Sprint, error)
+	UpdateSprint(sprintID int, args map[string]string) (jira.Sprint, error)
+	DeleteSprint(sprintID int) error
+	MoveIssuesToSprint(sprintID int, issueIDs []string) error
+}
+
+// PagePublisher publishes the pages to Confluence.
+type PagePublisher interface {
+	GetContentByTitle(space string, title string) (Content, error)
+	GetContent(id string) (Content, error)
+	CreateContent(content Content) (Content, error)
+	UpdateContent(content Content) (Content, error)
+	DeleteContent(id string) error
+}
+
+// ChatNotifier sends messages to the chat channels.
+type ChatNotifier interface {
+	PostMessage(channel string, user string, text string) error
+	// PostBlocks posts the Block Kit message with the plain text fallback,
+	// as a reply in the thread if threadTS is not empty, and returns the
+	// timestamp of the posted message.
+	PostBlocks(channel string, user string, text string, blocks []slackBlock, threadTS string) (string, error)
+	// GetUserIDs returns the chat user IDs keyed by the lower case emails.
+	GetUserIDs() (map[string]string, error)
+}
+
+// Reporter generates the reports and rotates the sprints for one
+// configuration with the services it owns.
+type Reporter struct {
+	config *Config
+	dryRun bool
+
+	issues  IssueSource
+	tracker IssueTracker
+	sprints SprintManager
+	pages   PagePublisher
+	chat    ChatNotifier
+
+	repoQuery  string
+	allMembers []string
+
+	// The context of the running command, shared with the services.
+	reqCtx *requestContext
+
+	// Protects the lazily loaded chat users from the parallel fetches.
+	lazyMu sync.Mutex
+	// The chat user IDs keyed by the lower case emails, loaded lazily.
+	chatUsers     map[string]string
+	chatUsersInit bool
+
+	// Protects the Jira fields on its own, so the mentions don't wait on
+	// the discovery.
+	jiraFieldsMu sync.Mutex
+	// The Jira custom field IDs, discovered lazily.
+	jiraFields     JiraFields
+	jiraFieldsInit bool
+}
+
+// NewReporter creates the Reporter with the services of the configuration.
+func NewReporter(cfg *Config, dryRun bool) (*Reporter, error) {
+	// All the requests are sent with the context of the running command.
+	reqCtx := newRequestContext()
+	githubTransport, jiraTransport := newCachingTransports(cfg.Cache)
+	issues, err := newGithubIssueSource(cfg.Github, reqCtx, githubTransport)
+	if err != nil {
+		return nil, err
+	}
+
+	jiraService, err := newJiraService(cfg.Jira, newContextTransport(reqCtx, jiraTransport), newContextTransport(reqCtx, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	// In our company, we use same user and password for Jira and Confluence.
+	if len(cfg.Confluence.User) == 0 {
+		cfg.Confluence.User = cfg.Jira.User
+	}
+
+	if len(cfg.Confluence.Password) == 0 {
+		cfg.Confluence.Password = cfg.Jira.Password
+	}
+
+	pages, err := newConfluencePublisher(cfg.Confluence, newContextTransport(reqCtx, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	chat, err := newSlackNotifier(cfg.Slack, reqCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newReporterWithServices(cfg, issues, jiraService, jiraService, pages, chat)
+	r.dryRun = dryRun
+	r.reqCtx = reqCtx
+	return r, nil
+}
+
+// newReporterWithServices creates the Reporter with the given services,
+// e.g, the fake ones in tests.
+func newReporterWithServices(cfg *Config, issues IssueSource, tracker IssueTracker,
+	sprints SprintManager, pages PagePublisher, chat ChatNotifier) *Reporter {
+	r := &Reporter{
+		config:  cfg,
+		issues:  issues,
+		tracker: tracker,
+		sprints: sprints,
+		pages:   pages,
+		chat:    chat,
+		reqCtx:  newRequestContext(),
+	}
+
+	r.repoQuery = "repo:" + strings.Join(cfg.Github.Repos, " repo:")
+	for _, team := range cfg.Teams {
+		for _, member := range team.Members {
+			r.allMembers = append(r.allMembers, member.Github)
+		}
+	}
+	return r
+}
+
+// forTeam returns a Reporter sharing the services, scoped to the repos,
+// the Jira project, the OnCall project and the Slack channel of the team.
+// The members of all the teams are kept, so the other teams are not the
+// community in the team's reports.
+func (r *Reporter) forTeam(team Team) *Reporter {
+	cfg := *r.config
+	if len(team.Repos) > 0 {
+		cfg.Github.Repos = team.Repos
+	}
+	if len(team.Project) > 0 {
+		cfg.Jira.Project = team.Project
+	}
+	if len(team.Channel) > 0 {
+		cfg.Slack.Channel = team.Channel
+	}
+	if len(team.OnCall) > 0 {
+		cfg.Jira.OnCall = team.OnCall
+	}
+
+	t := newReporterWithServices(&cfg, r.issues, r.tracker, r.sprints, r.pages, r.chat)
+	t.dryRun = r.dryRun
+	t.reqCtx = r.reqCtx
+	return t
+}
+
+// isTeamMember returns whether the GitHub login belongs to the team members.
+func (r *Reporter) isTeamMember(login string) bool {
+	for _, id := range r.allMembers {
+		if strings.EqualFold(id, login) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/google/go-github/github"
+)
+
+// memServices implements all the services in memory and records the calls.
+type memServices struct {
+	githubIssues []github.Issue
+	jiraIssues   []jira.Issue
+	sprints      []jira.Sprint
+	userIDs      map[string]string
+	prFiles      map[string][]string
+	reviews      map[string][]github.PullRequestReview
+	failOn       string
+	// afterCall is called after every call is recorded if set.
+	afterCall func(call string)
+
+	calls    []string
+	messages []string
+}
+
+func (m *memServices) call(format string, args ...interface{}) error {
+	c := fmt.Sprintf(format, args...)
+	m.calls = append(m.calls, c)
+	if m.afterCall != nil {
+		m.afterCall(c)
+	}
+	if len(m.failOn) > 0 && strings.HasPrefix(c, m.failOn) {
+		return errors.New("injected failure")
+	}
+	return nil
+}
+
+func (m *memServices) SearchIssues(query string, sort string) ([]github.Issue, bool, error) {
+	return m.githubIssues, false, m.call("SearchIssues %s", query)
+}
+
+func (m *memServices) AddAssignees(repo string, number int, assignees []string) error {
+	return m.call("AddAssignees %s#%d %s", repo, number, strings.Join(assignees, ","))
+}
+
+func (m *memServices) ListPullRequestFiles(repo string, number int) ([]string, error) {
+	return m.prFiles[fmt.Sprintf("%s#%d", repo, number)], m.call("ListPullRequestFiles %s#%d", repo, number)
+}
+
+func (m *memServices) ListReviews(repo string, number int) ([]github.PullRequestReview, error) {
+	return m.reviews[fmt.Sprintf("%s#%d", repo, number)], m.call("ListReviews %s#%d", repo, number)
+}
+
+func (m *memServices) GetIssue(key string) (*jira.Issue, error) {
+	return &jira.Issue{Key: key}, m.call("GetIssue %s", key)
+}
+
+func (m *memServices) GetBoardID(project string, boardType string) (int, error) {
+	return 1, m.call("GetBoardID %s %s", project, boardType)
+}
+
+func (m *memServices) GetSprints(boardID int, state string) ([]jira.Sprint, error) {
+	var sprints []jira.Sprint
+	for _, s := range m.sprints {
+		if len(state) == 0 || s.State == state {
+			sprints = append(sprints, s)
+		}
+	}
+	return sprints, m.call("GetSprints %d %s", boardID, state)
+}
+
+func (m *memServices) CreateSprint(boardID int, name string, startDate, endDate string) (jira.Sprint, error) {
+	start, _ := time.Parse(dateFormat, startDate)
+	end, _ := time.Parse(dateFormat, endDate)
+	sprint := jira.Sprint{ID: len(m.sprints) + 1, Name: name, State: "future", StartDate: &start, EndDate: &end}
+	m.sprints = append(m.sprints, sprint)
+	return sprint, m.call("CreateSprint %s", name)
+}
+
+func (m *memServices) UpdateSprint(sprintID int, args map[string]string) (jira.Sprint, error) {
+	if err := m.call("UpdateSprint %d %s", sprintID, args["state"]); err != nil {
+		return jira.Sprint{}, err
+	}
+	for i := range m.sprints {
+		if m.sprints[i].ID == sprintID && len(args["state"]) > 0 {
+			m.sprints[i].State = args["state"]
+			return m.sprints[i], nil
+		}
+	}
+	return jira.Sprint{ID: sprintID}, nil
+}
+
+func (m *memServices) DeleteSprint(sprintID int) error {
+	return m.call("DeleteSprint %d", sprintID)
+}
+
+func (m *memServices) MoveIssuesToSprint(sprintID int, issueIDs []string) error {
+	return m.call("MoveIssuesToSprint %d %s", sprintID, strings.Join(issueIDs, ","))
+}
+
+func (m *memServices) GetContentByTitle(space string, title string) (Content, error) {
+	return Content{}, m.call("GetContentByTitle %s", title)
+}
+
+func (m *memServices) GetContent(id string) (Content, error) {
+	return Content{}, m.call("GetContent %s", id)
+}
+
+func (m *memServices) CreateContent(content Content) (Content, error) {
+	return content, m.call("CreateContent %s", content.Title)
+}
+
+func (m *memServices) UpdateContent(content Content) (Content, error) {
+	return content, m.call("UpdateContent %s", content.Title)
+}
+
+func (m *memServices) DeleteContent(id string) error {
+	return m.call("DeleteContent %s", id)
+}
+
+func (m *memServices) PostMessage(channel string, user string, text string) error {
+	m.messages = append(m.messages, text)
+	return m.call("PostMessage %s", channel)
+}
+
+func (m *memServices) PostBlocks(channel string, user string, text string, blocks []slackBlock, threadTS string) (string, error) {
+	m.messages = append(m.messages, text)
+	return "1", m.call("PostBlocks %s %d %s", channel, len(blocks), threadTS)
+}
+
+func (m *memServices) GetUserIDs() (map[string]string, error) {
+	return m.userIDs, m.call("GetUserIDs")
+}
+
+// memTracker disambiguates the Jira search from the GitHub one.
+type memTracker struct{ *memServices }
+
+func (m memTracker) GetFields() ([]jira.Field, error) {
+	return nil, m.call("GetFields")
+}
+
+func (m memTracker) SearchIssues(jql string, opts jiraSearchOptions, f func(jira.Issue) error) error {
+	if err := m.call("SearchJiraIssues %s", jql); err != nil {
+		return err
+	}
+	for _, issue := range m.jiraIssues {
+		if err := f(issue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newMemReporter(t *testing.T, m *memServices) *Reporter {
+	cfg := &Config{
+		Slack:  Slack{Channel: "team"},
+		Jira:   Jira{Project: "TIKV"},
+		Github: Github{Repos: []string{"tikv/tikv", "pingcap/pd"}},
+		// Fetch one by one so the calls are recorded in order.
+		Concurrency: 1,
+	}
+	if err := cfg.adjust(); err != nil {
+		t.Fatal(err)
+	}
+	return newReporterWithServices(cfg, m, memTracker{m}, m, m, m)
+}
+
+func TestRotateSprintStopsOnFailure(t *testing.T) {
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	end := start.Add(week)
+	m := &memServices{
+		sprints: []jira.Sprint{
+			{ID: 1, Name: "TIKV 2018-09-28 - 2018-10-04", State: "active", StartDate: &start, EndDate: &end},
+		},
+		jiraIssues: []jira.Issue{{ID: "10001", Key: "TIKV-1"}},
+		failOn:     "UpdateSprint 1 closed",
+	}
+	r := newMemReporter(t, m)
+
+	err := r.rotateSprint(time.Now())
+	if err == nil || !strings.Contains(err.Error(), "close sprint TIKV 2018-09-28 - 2018-10-04 failed") {
+		t.Fatalf("expect close failure, got %v", err)
+	}
+
+	last := m.calls[len(m.calls)-1]
+	if last != "UpdateSprint 1 closed" {
+		t.Errorf("expect rotation to stop after closing, last call is %q", last)
+	}
+	if len(m.messages) != 0 {
+		t.Errorf("unexpected messages %q", m.messages)
+	}
+}
+
+func TestGetIssuesQuery(t *testing.T) {
+	m := &memServices{
+		githubIssues: []github.Issue{
+			{HTMLURL: github.String("https://github.com/tikv/tikv/issues/2")},
+			{HTMLURL: github.String("https://github.com/tikv/tikv/issues/1")},
+		},
+	}
+	r := newMemReporter(t, m)
+
+	issues, err := r.getIssues("created", map[string]string{"is": "issue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.calls[0] != "SearchIssues repo:tikv/tikv repo:pingcap/pd is:issue" {
+		t.Errorf("unexpected query %q", m.calls[0])
+	}
+	if issues[0].GetHTMLURL() != "https://github.com/tikv/tikv/issues/1" {
+		t.Errorf("expect issues sorted by URL, got %v", issues)
+	}
+}
+
+func TestSendReportToSlackSplitsBlocks(t *testing.T) {
+	m := &memServices{}
+	r := newMemReporter(t, m)
+
+	section := slackSection{Title: "New Issues", Description: "New issues"}
+	for i := 0; i < 60; i++ {
+		section.Items = append(section.Items, fmt.Sprintf("issue %d", i))
+	}
+	if err := r.sendReportToSlack("Daily Report", []slackSection{section}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 header, 1 title, 1 context and 60 items.
+	expect := []string{"PostBlocks #team 50 ", "PostBlocks #team 13 1"}
+	if !reflect.DeepEqual(m.calls, expect) {
+		t.Errorf("expect calls %q, got %q", expect, m.calls)
+	}
+	if !strings.HasPrefix(m.messages[1], "• issue 47\n") {
+		t.Errorf("expect the reply to continue the items, got %q", m.messages[1])
+	}
+
+	r.config.Slack.PlainText = true
+	m.calls = nil
+	if err := r.sendReportToSlack("Daily Report", []slackSection{section}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.calls) != 1 || !strings.HasPrefix(m.calls[0], "PostMessage #team") {
+		t.Errorf("expect one plain text message, got %q", m.calls)
+	}
+}
+
+func TestBuildSlackMessagesWithoutDescription(t *testing.T) {
+	msgs := buildSlackMessages("Daily Report", []slackSection{{Title: "Custom", Items: []string{"item"}}})
+	if len(msgs) != 1 {
+		t.Fatalf("expect one message, got %d", len(msgs))
+	}
+	// 1 header, 1 title and 1 item.
+	for _, block := range msgs[0].Blocks {
+		if block.Type == "context" {
+			t.Fatalf("expect no context block, got %+v", msgs[0].Blocks)
+		}
+	}
+	if len(msgs[0].Blocks) != 3 {
+		t.Errorf("expect 3 blocks, got %+v", msgs[0].Blocks)
+	}
+}
+
+func TestFormatJiraIssueWithoutFields(t *testing.T) {
+	r := newMemReporter(t, &memServices{})
+	r.config.Jira.Endpoint = "https://jira.example.com/"
+
+	s := r.formatJiraIssueForSlackOutput(jira.Issue{Key: "TIKV-1"})
+	if expect := "[ Unknown / Unknown ] <https://jira.example.com/browse/TIKV-1|TIKV-1> "; s != expect {
+		t.Errorf("expect %q, got %q", expect, s)
+	}
+}
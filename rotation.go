@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+// The steps of the sprint rotation in order.
+const (
+	rotateStepCreate   = "create"
+	rotateStepMove     = "move"
+	rotateStepClose    = "close"
+	rotateStepActivate = "activate"
+	rotateStepNotify   = "notify"
+)
+
+// rotationJournal records the steps of the last sprint rotation of a
+// project, so the next run finishes a rotation which died halfway.
+type rotationJournal struct {
+	BoardID    int       `json:"board-id"`
+	FromSprint int       `json:"from-sprint"`
+	FromName   string    `json:"from-name"`
+	FromEnd    time.Time `json:"from-end"`
+	ToSprint   int       `json:"to-sprint"`
+	ToName     string    `json:"to-name"`
+	Moved      int       `json:"moved"`
+	Steps      []string  `json:"steps"`
+	StartedAt  time.Time `json:"started-at"`
+}
+
+func (j *rotationJournal) done(step string) bool {
+	for _, s := range j.Steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *rotationJournal) completed() bool {
+	return j.done(rotateStepNotify)
+}
+
+// describe describes the completed steps.
+func (j *rotationJournal) describe() string {
+	var steps []string
+	for _, step := range j.Steps {
+		switch step {
+		case rotateStepCreate:
+			steps = append(steps, fmt.Sprintf("created sprint %s", j.ToName))
+		case rotateStepMove:
+			steps = append(steps, fmt.Sprintf("moved %d issues to sprint %s", j.Moved, j.ToName))
+		case rotateStepClose:
+			steps = append(steps, fmt.Sprintf("closed sprint %s", j.FromName))
+		case rotateStepActivate:
+			steps = append(steps, fmt.Sprintf("activated sprint %s", j.ToName))
+		case rotateStepNotify:
+			steps = append(steps, "notified slack")
+		}
+	}
+	if len(steps) == 0 {
+		return "no step is completed"
+	}
+	return "completed steps: " + strings.Join(steps, ", ")
+}
+
+// fail returns the error with the steps completed before it.
+func (j *rotationJournal) fail(err error) error {
+	return fmt.Errorf("%v, %s", err, j.describe())
+}
+
+// loadRotationJournals loads the journals keyed by the projects, nothing is
+// loaded if the journal file is not configured.
+func (r *Reporter) loadRotationJournals() (map[string]*rotationJournal, error) {
+	journals := make(map[string]*rotationJournal)
+	path := r.config.Sprint.Journal
+	if len(path) == 0 {
+		return journals, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return journals, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &journals); err != nil {
+		return nil, fmt.Errorf("invalid rotation journal %s: %v", path, err)
+	}
+	return journals, nil
+}
+
+// recordRotationStep records the completed step in the journal.
+func (r *Reporter) recordRotationStep(journals map[string]*rotationJournal, j *rotationJournal, step string) error {
+	j.Steps = append(j.Steps, step)
+	return r.saveRotationJournals(journals, j)
+}
+
+// saveRotationJournals saves the journals, the journal is never written in
+// dry-run mode.
+func (r *Reporter) saveRotationJournals(journals map[string]*rotationJournal, j *rotationJournal) error {
+	path := r.config.Sprint.Journal
+	if r.dryRun || len(path) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(journals, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(path, data); err != nil {
+		return j.fail(fmt.Errorf("save rotation journal %s failed: %v", path, err))
+	}
+	return nil
+}
+
+// syncRotationJournal records the steps done on Jira but not in the
+// journal, e.g. the process died after closing the sprint. It returns false
+// if the rotation is stale, the old sprint is not active any more and the
+// new sprint has ended, so resuming it would skip the current rotation.
+func (r *Reporter) syncRotationJournal(j *rotationJournal, now time.Time) (bool, error) {
+	sprints, err := r.sprints.GetSprints(j.BoardID, "")
+	if err != nil {
+		return false, err
+	}
+	find := func(id int) *jira.Sprint {
+		for idx := range sprints {
+			if sprints[idx].ID == id {
+				return &sprints[idx]
+			}
+		}
+		return nil
+	}
+	from, to := find(j.FromSprint), find(j.ToSprint)
+	resume := (from != nil && from.State == "active") ||
+		(to != nil && (to.EndDate == nil || now.Before(*to.EndDate)))
+	if !resume {
+		return false, nil
+	}
+
+	if !j.done(rotateStepClose) && from != nil && from.State == "closed" {
+		j.Steps = append(j.Steps, rotateStepClose)
+	}
+	if to != nil && !j.done(rotateStepActivate) && to.State == "active" {
+		j.Steps = append(j.Steps, rotateStepActivate)
+	}
+	return true, nil
+}
+
+// rotateSprint closes the active sprint and activates the next one with the
+// unresolved issues. A rotation which died halfway is resumed while its
+// sprints are current, otherwise it is discarded, and the sprint activated
+// by the last rotation is not rotated again before it ends.
+func (r *Reporter) rotateSprint(now time.Time) error {
+	journals, err := r.loadRotationJournals()
+	if err != nil {
+		return err
+	}
+	project := r.config.Jira.Project
+	j := journals[project]
+
+	if j != nil && !j.completed() {
+		resume, err := r.syncRotationJournal(j, now)
+		if err != nil {
+			return j.fail(err)
+		}
+		if resume {
+			fmt.Printf("resume the rotation of sprint %s, %s\n", j.FromName, j.describe())
+			return r.runRotation(journals, j)
+		}
+		fmt.Printf("discard the stale rotation of sprint %s, %s\n", j.FromName, j.describe())
+	}
+
+	boardID, err := r.getBoardID()
+	if err != nil {
+		return err
+	}
+	activeSprint, err := r.getActiveSprint(boardID)
+	if err != nil {
+		return err
+	}
+	if activeSprint.EndDate == nil {
+		return fmt.Errorf("active sprint %s has no end date", activeSprint.Name)
+	}
+	if j != nil && j.ToSprint == activeSprint.ID && now.Before(*activeSprint.EndDate) {
+		return fmt.Errorf("sprint %s was rotated to at %s, refuse to rotate it again before it ends at %s",
+			activeSprint.Name, j.StartedAt.Format(dateFormat), activeSprint.EndDate.Format(dateFormat))
+	}
+	j = &rotationJournal{
+		BoardID:    boardID,
+		FromSprint: activeSprint.ID,
+		FromName:   activeSprint.Name,
+		FromEnd:    *activeSprint.EndDate,
+		StartedAt:  now,
+	}
+	journals[project] = j
+	return r.runRotation(journals, j)
+}
+
+// runRotation runs the steps not done in the journal.
+func (r *Reporter) runRotation(journals map[string]*rotationJournal, j *rotationJournal) error {
+	if !j.done(rotateStepCreate) {
+		nextSprint, err := r.createNextSprint(j.BoardID, j.FromEnd)
+		if err != nil {
+			return j.fail(fmt.Errorf("create next sprint failed: %v", err))
+		}
+		j.ToSprint, j.ToName = nextSprint.ID, nextSprint.Name
+		if err = r.recordRotationStep(journals, j, rotateStepCreate); err != nil {
+			return err
+		}
+	}
+
+	// Carry over the unfinished issues before closing the old sprint,
+	// otherwise Jira moves them back to the backlog.
+	if !j.done(rotateStepMove) {
+		if err := r.interrupted(); err != nil {
+			return j.fail(err)
+		}
+		unresolvedIssues, err := r.getUnresolvedSprintIssues(j.FromSprint)
+		if err != nil {
+			return j.fail(fmt.Errorf("query unresolved issues of sprint %s failed: %v", j.FromName, err))
+		}
+		// Save the count before moving, the issues are not in the old sprint
+		// any more if the move is done but not recorded.
+		if len(unresolvedIssues) > 0 {
+			j.Moved = len(unresolvedIssues)
+			if err = r.saveRotationJournals(journals, j); err != nil {
+				return err
+			}
+		}
+		if err = r.moveIssuesToSprint(j.ToSprint, unresolvedIssues); err != nil {
+			return j.fail(fmt.Errorf("move issues to sprint %s failed: %v", j.ToName, err))
+		}
+		if err = r.recordRotationStep(journals, j, rotateStepMove); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range []struct {
+		name   string
+		sprint int
+		state  string
+		desc   string
+	}{
+		{rotateStepClose, j.FromSprint, "closed", "close sprint " + j.FromName},
+		{rotateStepActivate, j.ToSprint, "active", "activate sprint " + j.ToName},
+	} {
+		if j.done(step.name) {
+			continue
+		}
+		if err := r.interrupted(); err != nil {
+			return j.fail(err)
+		}
+		if _, err := r.updateSprintState(step.sprint, step.state); err != nil {
+			return j.fail(fmt.Errorf("%s failed: %v", step.desc, err))
+		}
+		if err := r.recordRotationStep(journals, j, step.name); err != nil {
+			return err
+		}
+	}
+
+	err := r.sendToSlack("Current active Sprint %s is closed, %d unresolved issues are moved to Sprint %s",
+		j.FromName, j.Moved, j.ToName)
+	if err != nil {
+		return j.fail(err)
+	}
+	return r.recordRotationStep(journals, j, rotateStepNotify)
+}
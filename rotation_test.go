@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func newRotationServices() *memServices {
+	start := time.Date(2018, 9, 28, 0, 0, 0, 0, time.UTC)
+	end := start.Add(week)
+	return &memServices{
+		sprints: []jira.Sprint{
+			{ID: 1, Name: "TIKV 2018-09-28 - 2018-10-04", State: "active", StartDate: &start, EndDate: &end},
+		},
+		jiraIssues: []jira.Issue{{ID: "10001", Key: "TIKV-1"}},
+	}
+}
+
+func TestRotateSprintResumes(t *testing.T) {
+	m := newRotationServices()
+	m.failOn = "UpdateSprint 2 active"
+	r := newMemReporter(t, m)
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+	now := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	// The board is left without an active sprint.
+	err := r.rotateSprint(now)
+	if err == nil || !strings.Contains(err.Error(), "activate sprint TIKV 2018-10-05 - 2018-10-11 failed") ||
+		!strings.Contains(err.Error(), "closed sprint TIKV 2018-09-28 - 2018-10-04") {
+		t.Fatalf("expect activation failure with the completed steps, got %v", err)
+	}
+
+	m.failOn = ""
+	m.calls = nil
+	if err = r.rotateSprint(now); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"GetSprints 1 ", "UpdateSprint 2 active", "PostMessage #team"}
+	if !reflect.DeepEqual(m.calls, expect) {
+		t.Fatalf("expect only the remaining steps, got %q", m.calls)
+	}
+	if msg := m.messages[len(m.messages)-1]; !strings.Contains(msg, "1 unresolved issues are moved") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestRotateSprintResumesMovedCount(t *testing.T) {
+	m := newRotationServices()
+	r := newMemReporter(t, m)
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+	now := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	// The issues are moved on Jira, but the response is lost.
+	m.failOn = "MoveIssuesToSprint"
+	m.afterCall = func(c string) {
+		if strings.HasPrefix(c, "MoveIssuesToSprint") {
+			m.jiraIssues = nil
+		}
+	}
+	if err := r.rotateSprint(now); err == nil {
+		t.Fatal("expect the move failure")
+	}
+
+	m.failOn = ""
+	if err := r.rotateSprint(now); err != nil {
+		t.Fatal(err)
+	}
+	if msg := m.messages[len(m.messages)-1]; !strings.Contains(msg, "1 unresolved issues are moved") {
+		t.Errorf("expect the moved count kept, got %q", msg)
+	}
+}
+
+func TestRotateSprintSyncsJournal(t *testing.T) {
+	m := newRotationServices()
+	m.sprints[0].State = "closed"
+	next := jira.Sprint{ID: 2, Name: "TIKV 2018-10-05 - 2018-10-11", State: "future"}
+	m.sprints = append(m.sprints, next)
+	r := newMemReporter(t, m)
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+
+	// The process died after closing the sprint but before saving it.
+	data, _ := json.Marshal(map[string]*rotationJournal{
+		"TIKV": {BoardID: 1, FromSprint: 1, FromName: m.sprints[0].Name, ToSprint: 2, ToName: next.Name,
+			Moved: 1, Steps: []string{rotateStepCreate, rotateStepMove}},
+	})
+	if err := ioutil.WriteFile(r.config.Sprint.Journal, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.rotateSprint(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if m.calls[0] != "GetSprints 1 " || m.calls[1] != "UpdateSprint 2 active" {
+		t.Fatalf("expect the closed sprint not closed again, got %q", m.calls)
+	}
+
+	journals, err := r.loadRotationJournals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j := journals["TIKV"]; !j.completed() {
+		t.Fatalf("expect the rotation completed, got %v", j.Steps)
+	}
+}
+
+func TestRotateSprintRefusesTwice(t *testing.T) {
+	m := newRotationServices()
+	r := newMemReporter(t, m)
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+	now := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	if err := r.rotateSprint(now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next sprint is active until 2018-10-12.
+	m.calls = nil
+	err := r.rotateSprint(now.Add(time.Hour))
+	if err == nil || !strings.Contains(err.Error(), "refuse to rotate it again") {
+		t.Fatalf("expect the rotation refused, got %v", err)
+	}
+	for _, c := range m.calls {
+		if strings.HasPrefix(c, "CreateSprint") || strings.HasPrefix(c, "UpdateSprint") {
+			t.Fatalf("unexpected call %q", c)
+		}
+	}
+
+	// It is rotated again after the sprint ends.
+	if err = r.rotateSprint(now.Add(week)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateSprintDiscardsStaleJournal(t *testing.T) {
+	m := newRotationServices()
+	m.failOn = "PostMessage #team"
+	r := newMemReporter(t, m)
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+	now := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	// Only the notification fails in the first week.
+	if err := r.rotateSprint(now); err == nil {
+		t.Fatal("expect the notification failure")
+	}
+
+	// The next week rotates the sprint of the week instead of resuming.
+	m.failOn = ""
+	m.calls = nil
+	if err := r.rotateSprint(now.Add(week)); err != nil {
+		t.Fatal(err)
+	}
+	var created, closed bool
+	for _, c := range m.calls {
+		created = created || c == "CreateSprint TIKV 2018-10-12 - 2018-10-18"
+		closed = closed || c == "UpdateSprint 2 closed"
+	}
+	if !created || !closed {
+		t.Fatalf("expect sprint 2 rotated, got %q", m.calls)
+	}
+	journals, err := r.loadRotationJournals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j := journals["TIKV"]; j.FromSprint != 2 || !j.completed() {
+		t.Fatalf("expect the rotation of sprint 2 completed, got %+v", j)
+	}
+}
+
+func TestRotateSprintWithoutEndDate(t *testing.T) {
+	m := newRotationServices()
+	m.sprints[0].EndDate = nil
+	r := newMemReporter(t, m)
+
+	err := r.rotateSprint(time.Now())
+	if err == nil || !strings.Contains(err.Error(), "has no end date") {
+		t.Fatalf("expect error for the missing end date, got %v", err)
+	}
+}
+
+func TestRotateSprintDryRunKeepsJournal(t *testing.T) {
+	m := newRotationServices()
+	r := newMemReporter(t, m)
+	r.dryRun = true
+	r.config.Sprint.Journal = filepath.Join(t.TempDir(), "journal.json")
+
+	if err := r.rotateSprint(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(r.config.Sprint.Journal); err == nil {
+		t.Fatal("expect no journal in dry-run mode")
+	}
+}
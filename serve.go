@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	m := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the reports and the sprint rotation on schedule",
+		Run:   runServeCommandFunc,
+	}
+	return m
+}
+
+func runServeCommandFunc(cmd *cobra.Command, args []string) {
+	r := mustNewReporter()
+	ctx, cancel := newSignalContext()
+	defer cancel()
+	s, err := newScheduler(ctx, r, r.config.Serve, defaultStateFile(r.config.Serve))
+	perror(err)
+	s.run()
+}
+
+// The state file is next to the config file by default.
+func defaultStateFile(cfg Serve) string {
+	if len(cfg.StateFile) > 0 {
+		return cfg.StateFile
+	}
+	return filepath.Join(filepath.Dir(configFile), "serve-state.json")
+}
+
+// scheduledJob is a job run on the cron schedule.
+type scheduledJob struct {
+	name     string
+	schedule *cronSchedule
+	run      func(now time.Time) error
+}
+
+// scheduler runs the jobs on schedule and saves the last run time of each
+// job, so a restart neither runs a job twice nor skips a missed run.
+type scheduler struct {
+	jobs      []*scheduledJob
+	loc       *time.Location
+	stateFile string
+	lastRuns  map[string]time.Time
+
+	// The jobs are not started once the context is done.
+	ctx context.Context
+	now func() time.Time
+}
+
+// newScheduler creates the scheduler of the jobs, every run of a job is
+// cancelled with the context or after the deadline of its command.
+func newScheduler(ctx context.Context, r *Reporter, cfg Serve, stateFile string) (*scheduler, error) {
+	loc := time.Local
+	if len(cfg.Timezone) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &scheduler{
+		loc:       loc,
+		stateFile: stateFile,
+		lastRuns:  make(map[string]time.Time),
+		ctx:       ctx,
+		now:       time.Now,
+	}
+
+	for _, job := range []struct {
+		name    string
+		expr    string
+		timeout time.Duration
+		run     func(now time.Time) error
+	}{
+		{"daily", cfg.Daily, dailyTimeout, func(now time.Time) error { return r.runDailyReport(now.UTC()) }},
+		{"weekly-report", cfg.WeeklyReport, weeklyReportTimeout, func(time.Time) error { return r.runWeeklyReport() }},
+		{"rotate-sprint", cfg.RotateSprint, rotateSprintTimeout, func(now time.Time) error { return r.rotateSprint(now) }},
+	} {
+		if len(job.expr) == 0 {
+			continue
+		}
+		schedule, err := parseCron(job.expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", job.name, err)
+		}
+		run, timeout := job.run, commandTimeout(job.timeout)
+		s.jobs = append(s.jobs, &scheduledJob{
+			name:     job.name,
+			schedule: schedule,
+			run: func(now time.Time) error {
+				return r.runWithTimeout(ctx, timeout, func() error { return run(now) })
+			},
+		})
+	}
+	if len(s.jobs) == 0 {
+		return nil, fmt.Errorf("no job is scheduled, please configure the [serve] section")
+	}
+
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *scheduler) loadState() error {
+	data, err := ioutil.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.lastRuns)
+}
+
+func (s *scheduler) saveState() error {
+	data, err := json.MarshalIndent(s.lastRuns, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.stateFile, data)
+}
+
+// nextRun returns when the job should run next. A job which has never run
+// is scheduled from now, and a job which missed one or more runs since the
+// last run is due now, but only once.
+func (s *scheduler) nextRun(job *scheduledJob, now time.Time) time.Time {
+	last, ok := s.lastRuns[job.name]
+	if !ok {
+		return job.schedule.next(now.In(s.loc))
+	}
+	return job.schedule.next(last.In(s.loc))
+}
+
+// runDue runs all the jobs due at now and returns the earliest next run.
+func (s *scheduler) runDue(now time.Time) time.Time {
+	var next time.Time
+	for _, job := range s.jobs {
+		at := s.nextRun(job, now)
+		if !at.IsZero() && !at.After(now) {
+			if at.Before(now.Truncate(time.Minute)) {
+				fmt.Printf("catch up missed %s run at %s\n", job.name, at)
+			}
+			if s.stopped() {
+				return next
+			}
+			if err := job.run(now); err != nil {
+				fmt.Printf("%s failed: %v\n", job.name, err)
+			}
+			// An interrupted run is not recorded, so it is caught up after
+			// the restart.
+			if s.stopped() {
+				return next
+			}
+			// Record the run even if it fails, the partial report may have
+			// been sent already.
+			s.lastRuns[job.name] = now
+			if err := s.saveState(); err != nil {
+				fmt.Printf("save state to %s failed: %v\n", s.stateFile, err)
+			}
+			at = s.nextRun(job, now)
+		}
+		if next.IsZero() || (!at.IsZero() && at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+func (s *scheduler) stopped() bool {
+	return s.ctx != nil && s.ctx.Err() != nil
+}
+
+// run runs the jobs on schedule until the context is done.
+func (s *scheduler) run() {
+	names := make([]string, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		names = append(names, job.name)
+	}
+	sort.Strings(names)
+	fmt.Printf("serve %v in %s\n", names, s.loc)
+
+	for {
+		next := s.runDue(s.now())
+		if s.stopped() {
+			fmt.Println("serve is stopped")
+			return
+		}
+		if next.IsZero() {
+			fmt.Println("no more scheduled runs")
+			return
+		}
+		fmt.Printf("next run at %s\n", next)
+		// Wake up at once to stop if the context is done.
+		sleepContext(s.ctx, next.Sub(s.now()))
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/andygrunwald/go-jira"
@@ -11,82 +14,185 @@ import (
 	"github.com/nlopes/slack/slackutilsx"
 )
 
-// Use getSlackClient() to access it with lazy initialize feature.
-var slackClient *slack.Client = nil
+// slackNotifier is the ChatNotifier backed by the Slack Web API.
+type slackNotifier struct {
+	token      string
+	httpClient *http.Client
+	client     *slack.Client
+}
+
+// newSlackNotifier creates the notifier sending the requests with the
+// context of the command.
+func newSlackNotifier(cfg Slack, ctx *requestContext) (*slackNotifier, error) {
+	var transport http.RoundTripper
+	if len(cfg.Endpoint) > 0 {
+		if _, err := url.Parse(cfg.Endpoint); err != nil {
+			return nil, err
+		}
+		transport = slackEndpointTransport{endpoint: cfg.Endpoint}
+	}
+	httpClient := &http.Client{Transport: newContextTransport(ctx, transport)}
+	return &slackNotifier{
+		token:      cfg.Token,
+		httpClient: httpClient,
+		client:     slack.New(cfg.Token, slack.OptionHTTPClient(httpClient)),
+	}, nil
+}
+
+// slackEndpointTransport sends the requests for the default Slack API URL
+// to the configured endpoint.
+type slackEndpointTransport struct {
+	endpoint string
+}
+
+func (t slackEndpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rawURL := req.URL.String()
+	if strings.HasPrefix(rawURL, slack.APIURL) {
+		u, err := url.Parse(t.endpoint + strings.TrimPrefix(rawURL, slack.APIURL))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(req.Context())
+		req.URL = u
+		req.Host = u.Host
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (n *slackNotifier) PostMessage(channel string, user string, text string) error {
+	_, _, err := n.client.PostMessage(channel,
+		slack.MsgOptionUser(user),
+		slack.MsgOptionText(text, false))
+	return err
+}
 
-var slackMemberInit = false
-var slackMembers = map[string]string{}
+// PostBlocks posts the Block Kit message, the vendored slack package
+// doesn't support blocks yet so we call chat.postMessage directly.
+func (n *slackNotifier) PostBlocks(channel string, user string, text string, blocks []slackBlock, threadTS string) (string, error) {
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{
+		"token":   {n.token},
+		"channel": {channel},
+		"user":    {user},
+		"text":    {text},
+		"blocks":  {string(data)},
+	}
+	if len(threadTS) > 0 {
+		values.Set("thread_ts", threadTS)
+	}
+
+	resp, err := n.httpClient.PostForm(slack.APIURL+"chat.postMessage", values)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-func getSlackClient() *slack.Client {
-	if slackClient == nil {
-		slackClient = slack.New(config.Slack.Token)
+	res := struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("invalid slack response with status %s: %v", resp.Status, err)
 	}
-	return slackClient
+	if !res.Ok {
+		return "", fmt.Errorf("slack error: %s", res.Error)
+	}
+	return res.TS, nil
 }
 
-func initSlackMemberCache() {
-	if slackMemberInit {
-		return
+func (n *slackNotifier) GetUserIDs() (map[string]string, error) {
+	users, err := n.client.GetUsers()
+	if err != nil {
+		return nil, err
 	}
-	users, err := getSlackClient().GetUsers()
-	perror(err)
 	if len(users) == 0 {
-		perror(fmt.Errorf("cannot retrieve slack user list. slack app must be granted `users:read` and `users:read.email` permission"))
+		return nil, fmt.Errorf("cannot retrieve slack user list. slack app must be granted `users:read` and `users:read.email` permission")
 	}
 
+	ids := make(map[string]string, len(users))
 	for _, user := range users {
-		slackMembers[strings.ToLower(user.Profile.Email)] = user.ID
+		ids[strings.ToLower(user.Profile.Email)] = user.ID
 	}
-	slackMemberInit = true
+	return ids, nil
 }
 
-func buildSlackMention(email string) string {
-	initSlackMemberCache()
-	id, ok := slackMembers[strings.ToLower(email)]
+func (r *Reporter) initChatUsers() error {
+	r.lazyMu.Lock()
+	defer r.lazyMu.Unlock()
+	if r.chatUsersInit {
+		return nil
+	}
+	// Only try once, if it fails, we fall back to the plain emails.
+	r.chatUsersInit = true
+
+	users, err := r.chat.GetUserIDs()
+	if err != nil {
+		return err
+	}
+	r.chatUsers = users
+	return nil
+}
+
+func (r *Reporter) buildSlackMention(email string) string {
+	if err := r.initChatUsers(); err != nil {
+		fmt.Printf("can not load slack members, mention by email instead: %v\n", err)
+	}
+	id, ok := r.chatUsers[strings.ToLower(email)]
 	if !ok {
 		return slackutilsx.EscapeMessage(email)
 	}
 	return fmt.Sprintf("<@%s>", id)
 }
 
-func sendToSlack(format string, args ...interface{}) {
-	channelName := config.Slack.Channel
-	user := config.Slack.User
-
+// slackChannel returns the configured channel name with the "#" prefix.
+func (r *Reporter) slackChannel() (string, bool) {
+	channelName := r.config.Slack.Channel
 	if channelName == "" {
 		println("no slack channel name")
-		return
+		return "", false
 	}
 
 	if channelName[0] != '#' {
 		channelName = "#" + channelName
 	}
+	return channelName, true
+}
 
-	_, _, err := getSlackClient().PostMessage(channelName,
-		slack.MsgOptionUser(user),
-		slack.MsgOptionText(fmt.Sprintf(format, args...), false))
-	if err != nil {
-		perror(fmt.Errorf("can not post msg to slack with err: %v", err))
+func (r *Reporter) sendToSlack(format string, args ...interface{}) error {
+	channelName, ok := r.slackChannel()
+	if !ok {
+		return nil
+	}
+
+	if r.dryRun {
+		printDryRun(fmt.Sprintf("post message to slack channel %s", channelName), fmt.Sprintf(format, args...))
+		return nil
 	}
+
+	if err := r.chat.PostMessage(channelName, r.config.Slack.User, fmt.Sprintf(format, args...)); err != nil {
+		return fmt.Errorf("can not post msg to slack with err: %v", err)
+	}
+	return nil
 }
 
 func formatSectionForSlackOutput(buf *bytes.Buffer, title string, description string) {
 	buf.WriteString(fmt.Sprintf("*%s*\n", slackutilsx.EscapeMessage(title)))
-	buf.WriteString(fmt.Sprintf("> %s\n", slackutilsx.EscapeMessage(description)))
+	if len(description) > 0 {
+		buf.WriteString(fmt.Sprintf("> %s\n", slackutilsx.EscapeMessage(description)))
+	}
 }
 
-func formatGitHubIssueForSlackOutput(issue github.Issue) string {
-	isFromTeam := false
-	login := issue.GetUser().GetLogin()
+func formatFailureForSlackOutput(buf *bytes.Buffer, err error) {
+	buf.WriteString(fmt.Sprintf("_failed to load: %s_\n", slackutilsx.EscapeMessage(err.Error())))
+}
 
-	for _, id := range allMembers {
-		if strings.EqualFold(id, login) {
-			isFromTeam = true
-			break
-		}
-	}
+func (r *Reporter) formatGitHubIssueForSlackOutput(issue github.Issue) string {
 	var tp string
-	if !isFromTeam {
+	if !r.isTeamMember(issue.GetUser().GetLogin()) {
 		tp = " _(Community)_"
 	}
 	var closed string
@@ -96,7 +202,7 @@ func formatGitHubIssueForSlackOutput(issue github.Issue) string {
 
 	s := fmt.Sprintf(
 		"[ %s ]%s%s <%s|%s> by @%s",
-		slackutilsx.EscapeMessage(regexRepo.FindStringSubmatch(issue.GetHTMLURL())[1]),
+		slackutilsx.EscapeMessage(issueRepoName(issue)),
 		slackutilsx.EscapeMessage(closed),
 		slackutilsx.EscapeMessage(tp),
 		issue.GetHTMLURL(),
@@ -114,8 +220,8 @@ func formatGitHubIssueForSlackOutput(issue github.Issue) string {
 	return s
 }
 
-func formatJiraIssueForSlackOutput(issue jira.Issue) string {
-	link := fmt.Sprintf("%sbrowse/%s", config.Jira.Endpoint, issue.Key)
+func (r *Reporter) formatJiraIssueForSlackOutput(issue jira.Issue) string {
+	link := fmt.Sprintf("%sbrowse/%s", r.config.Jira.Endpoint, issue.Key)
 	status := "Unknown"
 	if issue.Fields != nil && issue.Fields.Status != nil {
 		status = issue.Fields.Status.Name
@@ -126,34 +232,18 @@ func formatJiraIssueForSlackOutput(issue jira.Issue) string {
 	}
 	assignment := ""
 	if issue.Fields != nil && issue.Fields.Assignee != nil {
-		assignment = fmt.Sprintf("assigned to %s", buildSlackMention(issue.Fields.Assignee.EmailAddress))
+		assignment = fmt.Sprintf("assigned to %s", r.buildSlackMention(issue.Fields.Assignee.EmailAddress))
+	}
+	summary := issue.Key
+	if issue.Fields != nil && len(issue.Fields.Summary) > 0 {
+		summary = issue.Fields.Summary
 	}
 	return fmt.Sprintf(
 		"[ %s / %s ] <%s|%s> %s",
 		slackutilsx.EscapeMessage(status),
 		slackutilsx.EscapeMessage(priority),
 		link,
-		slackutilsx.EscapeMessage(issue.Fields.Summary),
+		slackutilsx.EscapeMessage(summary),
 		assignment,
 	)
 }
-
-func formatGitHubIssuesForSlackOutput(buf *bytes.Buffer, issues []github.Issue) {
-	if len(issues) == 0 {
-		buf.WriteString("_None_\n")
-		return
-	}
-	for _, issue := range issues {
-		buf.WriteString(fmt.Sprintf("• %s\n", formatGitHubIssueForSlackOutput(issue)))
-	}
-}
-
-func formatJiraIssuesForSlackOutput(buf *bytes.Buffer, issues []jira.Issue) {
-	if len(issues) == 0 {
-		buf.WriteString("_None_\n")
-		return
-	}
-	for _, issue := range issues {
-		buf.WriteString(fmt.Sprintf("• %s\n", formatJiraIssueForSlackOutput(issue)))
-	}
-}
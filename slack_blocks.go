@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nlopes/slack/slackutilsx"
+)
+
+const (
+	// Slack accepts at most 50 blocks in one message.
+	slackMaxBlocks = 50
+	// The max length of the text in a section block.
+	slackMaxSectionText = 3000
+	// The max length of the text in a header block.
+	slackMaxHeaderText = 150
+)
+
+// slackText is a Block Kit text object.
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackBlock is a Block Kit layout block, only the header, context,
+// section and divider blocks are used.
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+func newSlackHeaderBlock(text string) slackBlock {
+	return slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateText(text, slackMaxHeaderText)}}
+}
+
+func newSlackContextBlock(mrkdwn string) slackBlock {
+	return slackBlock{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: mrkdwn}}}
+}
+
+func newSlackSectionBlock(mrkdwn string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncateText(mrkdwn, slackMaxSectionText)}}
+}
+
+func newSlackDividerBlock() slackBlock {
+	return slackBlock{Type: "divider"}
+}
+
+func truncateText(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// slackSection is a section of the report sent to Slack, the items are
+// already formatted in mrkdwn.
+type slackSection struct {
+	Title       string
+	Description string
+	Items       []string
+	Err         error
+}
+
+// slackMessage is one message of the report, with the blocks and the
+// plain text fallback of them.
+type slackMessage struct {
+	Text   string
+	Blocks []slackBlock
+}
+
+// buildSlackMessages renders the report as Block Kit messages. A section
+// can be split into the next message if there are too many items.
+func buildSlackMessages(title string, sections []slackSection) []slackMessage {
+	var msgs []slackMessage
+	cur := slackMessage{}
+	add := func(text string, blocks ...slackBlock) {
+		if len(cur.Blocks)+len(blocks) > slackMaxBlocks {
+			msgs = append(msgs, cur)
+			cur = slackMessage{}
+		}
+		cur.Text += text
+		cur.Blocks = append(cur.Blocks, blocks...)
+	}
+
+	add(fmt.Sprintf("*%s*\n\n", slackutilsx.EscapeMessage(title)), newSlackHeaderBlock(title))
+	for i, section := range sections {
+		if i > 0 {
+			add("", newSlackDividerBlock())
+		}
+
+		var buf bytes.Buffer
+		formatSectionForSlackOutput(&buf, section.Title, section.Description)
+		blocks := []slackBlock{newSlackSectionBlock(fmt.Sprintf("*%s*", slackutilsx.EscapeMessage(section.Title)))}
+		// Slack rejects a context block with an empty text.
+		if len(section.Description) > 0 {
+			blocks = append(blocks, newSlackContextBlock(slackutilsx.EscapeMessage(section.Description)))
+		}
+		add(buf.String(), blocks...)
+
+		switch {
+		case section.Err != nil:
+			buf.Reset()
+			formatFailureForSlackOutput(&buf, section.Err)
+			add(buf.String(), newSlackSectionBlock(buf.String()))
+		case len(section.Items) == 0:
+			add("_None_\n", newSlackContextBlock("_None_"))
+		default:
+			for _, item := range section.Items {
+				add(fmt.Sprintf("• %s\n", item), newSlackSectionBlock(item))
+			}
+		}
+		add("\n")
+	}
+	return append(msgs, cur)
+}
+
+// formatSlackSections renders the report as one plain text message.
+func formatSlackSections(title string, sections []slackSection) string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("*%s*\n\n", slackutilsx.EscapeMessage(title)))
+	for _, section := range sections {
+		formatSectionForSlackOutput(&buf, section.Title, section.Description)
+		switch {
+		case section.Err != nil:
+			formatFailureForSlackOutput(&buf, section.Err)
+		case len(section.Items) == 0:
+			buf.WriteString("_None_\n")
+		default:
+			for _, item := range section.Items {
+				buf.WriteString(fmt.Sprintf("• %s\n", item))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// sendReportToSlack sends the report in Block Kit, the messages after the
+// first one are sent as the replies in its thread.
+func (r *Reporter) sendReportToSlack(title string, sections []slackSection) error {
+	if r.config.Slack.PlainText {
+		return r.sendToSlack("%s", formatSlackSections(title, sections))
+	}
+
+	channelName, ok := r.slackChannel()
+	if !ok {
+		return nil
+	}
+
+	msgs := buildSlackMessages(title, sections)
+	if r.dryRun {
+		for i, msg := range msgs {
+			printDryRun(fmt.Sprintf("post message %d/%d with %d blocks to slack channel %s", i+1, len(msgs), len(msg.Blocks), channelName), msg.Text)
+		}
+		return nil
+	}
+
+	var threadTS string
+	for _, msg := range msgs {
+		ts, err := r.chat.PostBlocks(channelName, r.config.Slack.User, msg.Text, msg.Blocks, threadTS)
+		if err != nil {
+			return fmt.Errorf("can not post msg to slack with err: %v", err)
+		}
+		if len(threadTS) == 0 {
+			threadTS = ts
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The default name of the sprints, like "TIKV 2018-10-05 - 2018-10-11".
+const defaultSprintName = `{{.Project}} {{.Start.Format "2006-01-02"}} - {{.End.Format "2006-01-02"}}`
+
+// The project rendering the sample sprint name in Sprint.validate.
+const sampleSprintProject = "SAMPLE"
+
+// sprintNameData is the data of the sprint name template, End is the last
+// day of the sprint and Number counts the sprints of the project from 1.
+type sprintNameData struct {
+	Project string
+	Start   time.Time
+	End     time.Time
+	Number  int
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) || strings.EqualFold(name, d.String()[:3]) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", name)
+}
+
+func (s Sprint) validate() error {
+	if s.Weeks < 1 || s.Weeks > 4 {
+		return fmt.Errorf("invalid sprint weeks %d, must be 1 to 4", s.Weeks)
+	}
+	if len(s.Weekday) > 0 {
+		if _, err := parseWeekday(s.Weekday); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid sprint timezone %q: %v", s.Timezone, err)
+	}
+	if _, err := template.New("sprint").Parse(s.Name); err != nil {
+		return fmt.Errorf("invalid sprint name %q: %v", s.Name, err)
+	}
+	// Only the sprints with the project in the name are rotated, so render
+	// a sample to check it.
+	start := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+	name, err := s.name(sampleSprintProject, start, s.end(start), 1)
+	if err != nil {
+		return fmt.Errorf("invalid sprint name %q: %v", s.Name, err)
+	}
+	if !strings.Contains(name, sampleSprintProject) {
+		return fmt.Errorf("invalid sprint name %q: must contain {{.Project}}", s.Name)
+	}
+	return nil
+}
+
+// duration returns the length of the sprints.
+func (s Sprint) duration() time.Duration {
+	return time.Duration(s.Weeks) * week
+}
+
+// location returns the timezone of the sprints, or nil to keep the one of
+// the dates from Jira. The config is validated in Config.adjust, so the
+// errors are ignored.
+func (s Sprint) location() *time.Location {
+	if len(s.Timezone) == 0 {
+		return nil
+	}
+	loc, _ := time.LoadLocation(s.Timezone)
+	return loc
+}
+
+// nextStart returns when the sprint after the one ending at end starts,
+// at 00:00 on the configured weekday in the timezone, or just at end if
+// no weekday is configured.
+func (s Sprint) nextStart(end time.Time) time.Time {
+	if loc := s.location(); loc != nil {
+		end = end.In(loc)
+	}
+	if len(s.Weekday) == 0 {
+		return end
+	}
+	weekday, _ := parseWeekday(s.Weekday)
+	start := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location())
+	if start.Before(end) {
+		start = start.AddDate(0, 0, 1)
+	}
+	for start.Weekday() != weekday {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// end returns the end of the sprint starting at start, the days are added
+// in the timezone so the sprint ends at the same time of the day.
+func (s Sprint) end(start time.Time) time.Time {
+	return start.AddDate(0, 0, 7*s.Weeks)
+}
+
+// name returns the name of the sprint in [start, end).
+func (s Sprint) name(project string, start time.Time, end time.Time, number int) (string, error) {
+	t, _ := template.New("sprint").Parse(s.Name)
+	var buf bytes.Buffer
+	err := t.Execute(&buf, sprintNameData{
+		Project: project,
+		Start:   start,
+		End:     end.Add(-time.Second),
+		Number:  number,
+	})
+	if err != nil {
+		return "", fmt.Errorf("can not build the sprint name: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestSprintNextStart(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Thursday 2018-10-04 12:00 in Shanghai.
+	end := time.Date(2018, 10, 4, 4, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		sprint Sprint
+		expect time.Time
+	}{
+		{Sprint{Weeks: 1}, end},
+		{Sprint{Weeks: 1, Weekday: "friday", Timezone: "Asia/Shanghai"}, time.Date(2018, 10, 5, 0, 0, 0, 0, shanghai)},
+		{Sprint{Weeks: 1, Weekday: "Thu", Timezone: "Asia/Shanghai"}, time.Date(2018, 10, 11, 0, 0, 0, 0, shanghai)},
+		{Sprint{Weeks: 1, Weekday: "Thu", Timezone: "UTC"}, time.Date(2018, 10, 11, 0, 0, 0, 0, time.UTC)},
+		{Sprint{Weeks: 1, Weekday: "Mon"}, time.Date(2018, 10, 8, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range tbl {
+		if got := c.sprint.nextStart(end); !got.Equal(c.expect) {
+			t.Errorf("%+v: expect %s, got %s", c.sprint, c.expect, got)
+		}
+	}
+
+	// The sprint ending at 00:00 on the weekday is followed at once.
+	s := Sprint{Weeks: 1, Weekday: "Fri", Timezone: "Asia/Shanghai"}
+	friday := time.Date(2018, 10, 5, 0, 0, 0, 0, shanghai)
+	if got := s.nextStart(friday); !got.Equal(friday) {
+		t.Errorf("expect %s, got %s", friday, got)
+	}
+}
+
+func TestSprintName(t *testing.T) {
+	start := time.Date(2018, 10, 5, 0, 0, 0, 0, time.UTC)
+	s := Sprint{Weeks: 2, Name: defaultSprintName}
+	name, err := s.name("TIKV", start, s.end(start), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "TIKV 2018-10-05 - 2018-10-18" {
+		t.Errorf("unexpected name %q", name)
+	}
+
+	s.Name = "{{.Project}} Sprint {{.Number}}"
+	if name, _ = s.name("TIKV", start, s.end(start), 3); name != "TIKV Sprint 3" {
+		t.Errorf("unexpected name %q", name)
+	}
+
+	s.Name = "{{.Project}} {{.Unknown}}"
+	if _, err = s.name("TIKV", start, s.end(start), 3); err == nil {
+		t.Error("expect error for unknown field")
+	}
+}
+
+func TestSprintValidate(t *testing.T) {
+	tbl := []struct {
+		sprint Sprint
+		err    string
+	}{
+		{Sprint{Weeks: 5, Name: defaultSprintName}, "invalid sprint weeks"},
+		{Sprint{Weeks: 1, Weekday: "someday", Name: defaultSprintName}, "invalid weekday"},
+		{Sprint{Weeks: 1, Timezone: "Nowhere/City", Name: defaultSprintName}, "invalid sprint timezone"},
+		{Sprint{Weeks: 1, Name: "{{.Project"}, "invalid sprint name"},
+		{Sprint{Weeks: 1, Name: "{{.Project}} {{.Unknown}}"}, "invalid sprint name"},
+		{Sprint{Weeks: 1, Name: "Sprint {{.Number}}"}, "must contain {{.Project}}"},
+	}
+	for _, c := range tbl {
+		cfg := Config{Sprint: c.sprint}
+		if err := cfg.adjust(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%+v: expect error %q, got %v", c.sprint, c.err, err)
+		}
+	}
+
+	cfg := Config{}
+	if err := cfg.adjust(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sprint.Weeks != 1 || cfg.Sprint.Name != defaultSprintName {
+		t.Errorf("unexpected defaults %+v", cfg.Sprint)
+	}
+}
+
+func TestCreateNextSprintWithCadence(t *testing.T) {
+	start := time.Date(2018, 9, 21, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 14)
+	m := &memServices{
+		sprints: []jira.Sprint{
+			{ID: 1, Name: "TIKV Sprint 1", State: "active", StartDate: &start, EndDate: &end},
+			{ID: 2, Name: "PD Sprint 1", State: "closed", StartDate: &start, EndDate: &end},
+		},
+	}
+	r := newMemReporter(t, m)
+	r.config.Sprint = Sprint{Weeks: 2, Weekday: "Mon", Name: "{{.Project}} Sprint {{.Number}} ({{.Start.Format \"Jan 2\"}} - {{.End.Format \"Jan 2\"}})"}
+
+	sprint, err := r.createNextSprint(1, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sprint.Name != "TIKV Sprint 2 (Oct 8 - Oct 21)" {
+		t.Errorf("unexpected name %q", sprint.Name)
+	}
+	if expect := time.Date(2018, 10, 8, 0, 0, 0, 0, time.UTC); !sprint.StartDate.Equal(expect) {
+		t.Errorf("expect start %s, got %s", expect, sprint.StartDate)
+	}
+	if expect := time.Date(2018, 10, 22, 0, 0, 0, 0, time.UTC); !sprint.EndDate.Equal(expect) {
+		t.Errorf("expect end %s, got %s", expect, sprint.EndDate)
+	}
+
+	// The created sprint is reused.
+	again, err := r.createNextSprint(1, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != sprint.ID || len(m.sprints) != 3 {
+		t.Errorf("expect sprint %d reused, got %d with %d sprints", sprint.ID, again.ID, len(m.sprints))
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/cobra"
+)
+
+var triageSince time.Duration
+
+func newTriageAssignCommand() *cobra.Command {
+	m := &cobra.Command{
+		Use:   "assign",
+		Short: "Assign the unassigned community issues and PRs",
+		Run:   runTriageAssignCommandFunc,
+	}
+	m.Flags().DurationVar(&triageSince, "since", 24*time.Hour, "Assign the issues and PRs created in the duration")
+	return m
+}
+
+func newTriageCommand() *cobra.Command {
+	m := &cobra.Command{
+		Use:   "triage",
+		Short: "Triage Tasks",
+	}
+	m.AddCommand(newTriageAssignCommand())
+	return m
+}
+
+func runTriageAssignCommandFunc(cmd *cobra.Command, args []string) {
+	runCommand(triageTimeout, func(r *Reporter) error { return r.runTriageAssign(time.Now().UTC(), triageSince) })
+}
+
+// triageAssignment is the assignee chosen for an issue or PR.
+type triageAssignment struct {
+	issue    github.Issue
+	assignee string
+	reason   string
+}
+
+// runTriageAssign assigns the open community issues and PRs created since
+// now-since that nobody is assigned to. A PR goes to the owner of most of
+// its changed files, and the others go to the team members in turn.
+func (r *Reporter) runTriageAssign(now time.Time, since time.Duration) error {
+	members := r.triageMembers()
+	if len(members) == 0 {
+		return fmt.Errorf("no team member to assign to")
+	}
+
+	start := now.Add(-since).Format(githubUTCDateFormat)
+	issues, err := r.getUnassignedIssues(&start, nil)
+	if err != nil {
+		return err
+	}
+	issues = r.filterCommunityIssues(issues)
+
+	var errs reportErrors
+	// Rotate the first member every day, so the runs share the load.
+	next := int(now.Unix()/86400) % len(members)
+	assignments := make([]triageAssignment, 0, len(issues))
+	for _, issue := range issues {
+		a := triageAssignment{issue: issue}
+		if issue.IsPullRequest() && len(r.config.Triage.Owners) > 0 {
+			owner, err := r.findPullRequestOwner(issue)
+			errs.add(issue.GetHTMLURL(), err)
+			if len(owner) > 0 {
+				a.assignee, a.reason = owner, "owner"
+			}
+		}
+		if len(a.assignee) == 0 {
+			a.assignee, a.reason = members[next], "round-robin"
+			next = (next + 1) % len(members)
+		}
+
+		if err := r.addAssignees(issue, []string{a.assignee}); err != nil {
+			errs.add(issue.GetHTMLURL(), err)
+			continue
+		}
+		assignments = append(assignments, a)
+	}
+
+	if len(assignments) > 0 {
+		errs.add("Slack", r.sendReportToSlack("Triage", []slackSection{r.genTriageAssignSection(assignments)}))
+	}
+	return errs.toError()
+}
+
+// triageMembers returns the GitHub logins the issues are assigned to in
+// turn, the members without a login are skipped and the ones in several
+// teams are taken once.
+func (r *Reporter) triageMembers() []string {
+	var members []string
+	seen := make(map[string]bool)
+	for _, login := range r.allMembers {
+		key := strings.ToLower(login)
+		if len(login) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		members = append(members, login)
+	}
+	return members
+}
+
+// findPullRequestOwner returns the owner of most of the files changed by the
+// PR, or empty if no file has an owner. The longest matched path prefix wins.
+func (r *Reporter) findPullRequestOwner(issue github.Issue) (string, error) {
+	repo, err := issueRepo(issue)
+	if err != nil {
+		return "", err
+	}
+	files, err := r.issues.ListPullRequestFiles(repo, issue.GetNumber())
+	if err != nil {
+		return "", err
+	}
+
+	prefixes := make([]string, 0, len(r.config.Triage.Owners))
+	for prefix := range r.config.Triage.Owners {
+		prefixes = append(prefixes, prefix)
+	}
+	// Longer prefixes first, and sorted for the stable result.
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	counts := make(map[string]int)
+	for _, file := range files {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(file, strings.TrimPrefix(prefix, "/")) {
+				counts[r.config.Triage.Owners[prefix]]++
+				break
+			}
+		}
+	}
+
+	var owner string
+	for o, n := range counts {
+		// The author can not review the PR.
+		if strings.EqualFold(o, issue.GetUser().GetLogin()) {
+			continue
+		}
+		if n > counts[owner] || (n == counts[owner] && o < owner) {
+			owner = o
+		}
+	}
+	return owner, nil
+}
+
+func (r *Reporter) genTriageAssignSection(assignments []triageAssignment) slackSection {
+	s := slackSection{
+		Title:       "Assignments",
+		Description: fmt.Sprintf("%d unassigned community issues and PRs are assigned", len(assignments)),
+	}
+	for _, a := range assignments {
+		s.Items = append(s.Items, fmt.Sprintf("%s to @%s (%s)", r.formatGitHubIssueForSlackOutput(a.issue), a.assignee, a.reason))
+	}
+	return s
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func newTriageReporter(t *testing.T, m *memServices) *Reporter {
+	r := newMemReporter(t, m)
+	r.config.Teams = []Team{{Name: "Team", Members: []Member{{Github: "alice"}, {Github: "bob"}, {Github: "carol"}}}}
+	r.config.Triage.Owners = map[string]string{"src/raft/": "carol", "src/": "bob"}
+	return newReporterWithServices(r.config, m, memTracker{m}, m, m, m)
+}
+
+func triageIssues() []github.Issue {
+	return []github.Issue{
+		{
+			Number:  github.Int(1),
+			HTMLURL: github.String("https://github.com/tikv/tikv/issues/1"),
+			User:    &github.User{Login: github.String("outsider")},
+		},
+		{
+			Number:           github.Int(2),
+			HTMLURL:          github.String("https://github.com/tikv/tikv/pull/2"),
+			User:             &github.User{Login: github.String("outsider")},
+			PullRequestLinks: &github.PullRequestLinks{},
+		},
+		{
+			Number:  github.Int(3),
+			HTMLURL: github.String("https://github.com/tikv/tikv/issues/3"),
+			User:    &github.User{Login: github.String("alice")},
+		},
+		{
+			Number:  github.Int(4),
+			HTMLURL: github.String("https://github.com/tikv/tikv/issues/4"),
+			User:    &github.User{Login: github.String("outsider")},
+		},
+	}
+}
+
+func TestTriageAssign(t *testing.T) {
+	m := &memServices{
+		githubIssues: triageIssues(),
+		prFiles: map[string][]string{
+			"tikv/tikv#2": {"src/raft/a.rs", "src/raft/b.rs", "src/server/c.rs"},
+		},
+	}
+	r := newTriageReporter(t, m)
+
+	// The day rotates the first member to bob.
+	now := time.Unix(86400, 0)
+	if err := r.runTriageAssign(now, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var assigns []string
+	for _, c := range m.calls {
+		if strings.HasPrefix(c, "AddAssignees") {
+			assigns = append(assigns, c)
+		}
+	}
+	// The issues are sorted by URL, and the PR goes to the owner of most files.
+	expect := []string{
+		"AddAssignees tikv/tikv#1 bob",
+		"AddAssignees tikv/tikv#4 carol",
+		"AddAssignees tikv/tikv#2 carol",
+	}
+	if !reflect.DeepEqual(assigns, expect) {
+		t.Errorf("expect %q, got %q", expect, assigns)
+	}
+	if !strings.HasPrefix(m.calls[0], "SearchIssues repo:tikv/tikv repo:pingcap/pd ") ||
+		!strings.Contains(m.calls[0], " no:assignee") || !strings.Contains(m.calls[0], " created:>=1970-01-01T00:00:00Z") {
+		t.Errorf("unexpected query %q", m.calls[0])
+	}
+
+	if len(m.messages) != 1 || !strings.Contains(m.messages[0], "|> by @outsider to @carol (owner)") {
+		t.Errorf("unexpected messages %q", m.messages)
+	}
+}
+
+func TestTriageAssignSkipsMembers(t *testing.T) {
+	m := &memServices{githubIssues: triageIssues()}
+	r := newMemReporter(t, m)
+	r.config.Teams = []Team{
+		{Name: "Storage", Members: []Member{{Name: "Alice", Github: "alice"}, {Name: "Dave"}}},
+		{Name: "Scheduling", Members: []Member{{Name: "Alice", Github: "Alice"}, {Name: "Bob", Github: "bob"}}},
+	}
+	r = newReporterWithServices(r.config, m, memTracker{m}, m, m, m)
+
+	if err := r.runTriageAssign(time.Unix(0, 0), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var assigns []string
+	for _, c := range m.calls {
+		if strings.HasPrefix(c, "AddAssignees") {
+			assigns = append(assigns, c)
+		}
+	}
+	// Only alice and bob are in turn.
+	expect := []string{
+		"AddAssignees tikv/tikv#1 alice",
+		"AddAssignees tikv/tikv#4 bob",
+		"AddAssignees tikv/tikv#2 alice",
+	}
+	if !reflect.DeepEqual(assigns, expect) {
+		t.Errorf("expect %q, got %q", expect, assigns)
+	}
+}
+
+func TestTriageAssignUnknownRepo(t *testing.T) {
+	m := &memServices{
+		githubIssues: []github.Issue{
+			{
+				Number:  github.Int(2),
+				HTMLURL: github.String("https://github.example.com/tikv"),
+				User:    &github.User{Login: github.String("outsider")},
+			},
+		},
+	}
+	r := newTriageReporter(t, m)
+
+	err := r.runTriageAssign(time.Unix(0, 0), 24*time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "unknown repository of https://github.example.com/tikv") {
+		t.Fatalf("expect the unknown repository reported, got %v", err)
+	}
+	for _, c := range m.calls {
+		if strings.HasPrefix(c, "AddAssignees") {
+			t.Errorf("unexpected call %q", c)
+		}
+	}
+}
+
+func TestTriageAssignEnterprise(t *testing.T) {
+	m := &memServices{
+		githubIssues: []github.Issue{{
+			Number:           github.Int(1),
+			HTMLURL:          github.String("https://github.example.com/tikv/tikv/pull/1"),
+			User:             &github.User{Login: github.String("outsider")},
+			PullRequestLinks: &github.PullRequestLinks{},
+		}},
+		prFiles: map[string][]string{"tikv/tikv#1": {"src/raft/a.rs"}},
+	}
+	r := newTriageReporter(t, m)
+
+	if err := r.runTriageAssign(time.Unix(0, 0), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.messages) != 1 || !strings.Contains(m.messages[0], "[ tikv/tikv ]") || !strings.Contains(m.messages[0], "to @carol (owner)") {
+		t.Errorf("unexpected messages %q", m.messages)
+	}
+}
+
+func TestTriageAssignDryRun(t *testing.T) {
+	m := &memServices{githubIssues: triageIssues()}
+	r := newTriageReporter(t, m)
+	r.dryRun = true
+
+	if err := r.runTriageAssign(time.Now(), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range m.calls {
+		if strings.HasPrefix(c, "AddAssignees") || strings.HasPrefix(c, "PostBlocks") {
+			t.Errorf("unexpected call %q in dry-run", c)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -9,3 +13,47 @@ func escaperValue(value string) string {
 	value = strings.ReplaceAll(value, "&", "&amp;")
 	return value
 }
+
+// writeFileAtomic writes to a temporary file first and renames it to the
+// path, so a crash never leaves a broken file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// printDryRun prints what would be sent to the remote service in dry-run mode.
+func printDryRun(action string, body string) {
+	fmt.Printf("[dry-run] %s\n", action)
+	if len(body) > 0 {
+		fmt.Println(body)
+	}
+}
+
+// reportErrors collects the failures of report sections, so one failing
+// source does not lose the whole report.
+type reportErrors []error
+
+func (e *reportErrors) add(source string, err error) {
+	if err == nil {
+		return
+	}
+	*e = append(*e, fmt.Errorf("%s: %v", source, err))
+}
+
+// toError returns a summary of all the failures, or nil if nothing fails.
+func (e reportErrors) toError() error {
+	if len(e) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return fmt.Errorf("%d report sections failed:\n%s", len(e), strings.Join(msgs, "\n"))
+}
@@ -1,21 +1,20 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"html"
-	"strings"
+	"io/ioutil"
+	"os"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira"
 	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
 )
 
-const jiraLabelColorGrey = "Grey"
-const jiraLabelColorRed = "Red"
-const jiraLabelColorYellow = "Yellow"
-const jiraLabelColorGreen = "Green"
-const jiraLabelColorBlue = "Blue"
+var (
+	weeklyOutput  string
+	weeklyOutFile string
+)
 
 func newWeeklyReportCommand() *cobra.Command {
 	m := &cobra.Command{
@@ -23,6 +22,8 @@ func newWeeklyReportCommand() *cobra.Command {
 		Short: "Create Weekly Report",
 		Run:   runWeelyReportCommandFunc,
 	}
+	m.Flags().StringVar(&weeklyOutput, "output", outputConfluence, "Output format, confluence, markdown or html")
+	m.Flags().StringVar(&weeklyOutFile, "out-file", "", "Write the markdown or html report to the file instead of stdout")
 	return m
 }
 
@@ -46,11 +47,35 @@ func newWeeklyCommand() *cobra.Command {
 }
 
 func runWeelyReportCommandFunc(cmd *cobra.Command, args []string) {
-	boardID := getBoardID(config.Jira.Project, "scrum")
-	sprints := getSprints(boardID, jira.GetAllSprintsOptions{})
-	lastSprint := getNearestFutureSprint(sprints)
+	runCommand(weeklyReportTimeout, func(r *Reporter) error { return r.runWeeklyReportWithOutput(weeklyOutput, weeklyOutFile) })
+}
+
+// runWeeklyReport publishes the weekly report to Confluence.
+func (r *Reporter) runWeeklyReport() error {
+	return r.runWeeklyReportWithOutput(outputConfluence, "")
+}
 
-	var body bytes.Buffer
+// runWeeklyReportWithOutput publishes the weekly report to Confluence, or
+// writes it with the member pages to the file in Markdown or HTML.
+func (r *Reporter) runWeeklyReportWithOutput(output string, outFile string) error {
+	var errs reportErrors
+	w, err := r.newPageWriter(output, &errs)
+	if err != nil {
+		return err
+	}
+
+	boardID, err := r.getBoardID()
+	if err != nil {
+		return err
+	}
+	sprints, err := r.sprints.GetSprints(boardID, "")
+	if err != nil {
+		return err
+	}
+	lastSprint := r.getNearestFutureSprint(sprints)
+	if lastSprint == nil {
+		return fmt.Errorf("no sprint found for project %s", r.config.Jira.Project)
+	}
 
 	startDate := lastSprint.StartDate.Format(dayFormat)
 	endDate := lastSprint.EndDate.Format(dayFormat)
@@ -58,318 +83,291 @@ func runWeelyReportCommandFunc(cmd *cobra.Command, args []string) {
 	githubStartDate := lastSprint.StartDate.UTC().Format(githubUTCDateFormat)
 	githubEndDate := lastSprint.EndDate.UTC().Format(githubUTCDateFormat)
 
-	formatPageBeginForHtmlOutput(&body)
+	w.beginPage(lastSprint.Name)
 
-	genWeeklyReportToc(&body)
-	genWeeklyReportIssuesPRs(&body, githubStartDate, githubEndDate)
-	genWeeklyReportOnCall(&body, startDate, endDate)
-	genWeeklyReportProjects(&body, lastSprint)
+	w.beginSection()
+	w.toc()
+	w.endSection()
+	r.genWeeklyReportIssuesPRs(w, githubStartDate, githubEndDate, &errs)
+	r.genWeeklyReportOnCall(w, startDate, endDate)
+	r.genWeeklyReportProjects(w, lastSprint, &errs)
 
-	formatPageEndForHtmlOutput(&body)
+	if output == outputConfluence {
+		w.endPage()
+		errs.add("Weekly Report", r.createWeeklyReport(lastSprint, w.String(), &errs))
+		return errs.toError()
+	}
 
-	createWeeklyReport(lastSprint, body.String())
+	// The member pages follow the report in the file.
+	members := r.allTeamMembers()
+	prs := r.getMemberPullRequests(members, lastSprint)
+	for i, m := range members {
+		w.beginSection()
+		w.heading(1, m.Name)
+		w.endSection()
+		r.genWeeklyUserPage(w, m, prs[i], lastSprint, &errs)
+	}
+	w.endPage()
+	errs.add("Weekly Report", writeOutFile(outFile, w.String()))
+	return errs.toError()
 }
 
-func runRotateSprintCommandFunc(cmd *cobra.Command, args []string) {
-	boardID := getBoardID(config.Jira.Project, "scrum")
-	activeSprint := getActiveSprint(boardID)
-	nextSprint := createNextSprint(boardID, *activeSprint.EndDate)
-
-	// Close the old sprint.
-	updateSprintState(activeSprint.ID, "closed")
-	// Active the next sprint.
-	updateSprintState(nextSprint.ID, "active")
-	sendToSlack("Current active Sprint %s is closed", activeSprint.Name)
+// writeOutFile writes the report to the file, or stdout if the file is empty.
+func writeOutFile(outFile string, value string) error {
+	if len(outFile) == 0 {
+		_, err := fmt.Fprint(os.Stdout, value)
+		return err
+	}
+	return ioutil.WriteFile(outFile, []byte(value), 0644)
 }
 
-func formatPageBeginForHtmlOutput(buf *bytes.Buffer) {
-	buf.WriteString(`<ac:layout>`)
+func runRotateSprintCommandFunc(cmd *cobra.Command, args []string) {
+	runCommand(rotateSprintTimeout, func(r *Reporter) error { return r.rotateSprint(time.Now()) })
 }
 
-func formatPageEndForHtmlOutput(buf *bytes.Buffer) {
-	buf.WriteString(`</ac:layout>`)
+// allTeamMembers returns the members of all the teams in order.
+func (r *Reporter) allTeamMembers() []Member {
+	var members []Member
+	for _, team := range r.config.Teams {
+		members = append(members, team.Members...)
+	}
+	return members
 }
 
-func formatSectionBeginForHtmlOutput(buf *bytes.Buffer) {
-	buf.WriteString(`<ac:layout-section ac:type="single"><ac:layout-cell><hr/>`)
-	buf.WriteString("\n")
+// memberPullRequests is the PRs a member merged and reviewed in the sprint.
+type memberPullRequests struct {
+	authored    []github.Issue
+	authoredErr error
+	reviewed    []reviewedPullRequest
+	reviewedErr error
 }
 
-func formatSectionEndForHtmlOutput(buf *bytes.Buffer) {
-	buf.WriteString(`</ac:layout-cell></ac:layout-section>`)
-	buf.WriteString("\n")
+// getMemberPullRequests fetches the PRs of the members in parallel, the
+// result of a member is at the same index.
+func (r *Reporter) getMemberPullRequests(members []Member, sprint *jira.Sprint) []memberPullRequests {
+	start := sprint.StartDate.UTC().Format(githubUTCDateFormat)
+	end := sprint.EndDate.UTC().Format(githubUTCDateFormat)
+	prs := make([]memberPullRequests, len(members))
+	r.runParallel(len(members)*2, func(i int) {
+		m, p := members[i/2], &prs[i/2]
+		if len(m.Github) == 0 {
+			return
+		}
+		if i%2 == 0 {
+			p.authored, p.authoredErr = r.getAuthoredPullRequests(m.Github, &start, &end)
+		} else {
+			p.reviewed, p.reviewedErr = r.getReviewPullRequests(m.Github, &start, &end)
+		}
+	})
+	return prs
 }
 
-func formatLabelForHtmlOutput(name string, color string) string {
-	s := fmt.Sprintf(`
-	<ac:structured-macro ac:macro-id="9f29312a-2730-48f0-ab6d-91d6bef3f016" ac:name="status" ac:schema-version="1">
-		<ac:parameter ac:name="colour">%s</ac:parameter>
-		<ac:parameter ac:name="title">%s</ac:parameter>
-	</ac:structured-macro>`, color, html.EscapeString(name))
-	return s
+func (r *Reporter) genWeeklyUserPage(w pageWriter, m Member, prs memberPullRequests, sprint *jira.Sprint, errs *reportErrors) {
+	w.beginSection()
+	w.heading(3, "Work")
+	w.quote("A summary of my work in this week")
+	w.paragraph("Please fill this section")
+	w.heading(3, "Next Week")
+	w.quote("A plan of the next week")
+	w.paragraph("Please fill this section")
+	w.endSection()
+
+	w.beginSection()
+	w.heading(3, "Issues in this week")
+	w.jiraIssues([]string{"key", "summary", "created", "updated", "status"},
+		fmt.Sprintf(`project = %s AND Sprint = %d AND assignee = "%s"`, r.config.Jira.Project, sprint.ID, m.Email))
+	w.endSection()
+
+	if len(m.Github) > 0 {
+		w.beginSection()
+		r.genAuthoredPullRequests(w, m.Github, prs.authored, prs.authoredErr, errs)
+		r.genReviewPullRequests(w, m.Github, prs.reviewed, prs.reviewedErr, errs)
+		w.endSection()
+	}
 }
 
-func formatGitHubIssueForHtmlOutput(issue github.Issue) string {
-	isFromTeam := false
-	login := issue.GetUser().GetLogin()
-
-	for _, id := range allMembers {
-		if strings.EqualFold(id, login) {
-			isFromTeam = true
-			break
-		}
+func (r *Reporter) genAuthoredPullRequests(w pageWriter, user string, issues []github.Issue, err error, errs *reportErrors) {
+	w.heading(3, "Merged PR")
+	if err != nil {
+		errs.add("Merged PR of "+user, err)
+		w.failure(err)
+		return
 	}
+	w.issues(r.newPageIssues(issues))
+}
 
-	var labelColor = jiraLabelColorGrey
-	if issue.GetState() == "closed" {
-		labelColor = jiraLabelColorGreen
+func (r *Reporter) genReviewPullRequests(w pageWriter, user string, prs []reviewedPullRequest, err error, errs *reportErrors) {
+	w.heading(3, "Review PR")
+	if err != nil {
+		errs.add("Review PR of "+user, err)
+		w.failure(err)
+		return
 	}
 
-	s := fmt.Sprintf(
-		`%s <a href="%s">%s</a> by @%s`,
-		formatLabelForHtmlOutput(regexRepo.FindStringSubmatch(issue.GetHTMLURL())[1], labelColor),
-		issue.GetHTMLURL(),
-		html.EscapeString(issue.GetTitle()),
-		html.EscapeString(issue.GetUser().GetLogin()),
-	)
+	var approved, changesRequested int
+	issues := make([]pageIssue, 0, len(prs))
+	for _, pr := range prs {
+		approved += pr.approved
+		changesRequested += pr.changesRequested
 
-	if issue.Assignees != nil && len(issue.Assignees) > 0 {
-		s += fmt.Sprintf(", assigned to")
-		for _, assigne := range issue.Assignees {
-			s += fmt.Sprintf(" @%s", assigne.GetLogin())
+		issue := r.newPageIssue(pr.issue)
+		if pr.approved > 0 {
+			issue.labels = append(issue.labels, pageLabel{"Approved", jiraLabelColorGreen})
 		}
+		if pr.changesRequested > 0 {
+			issue.labels = append(issue.labels, pageLabel{fmt.Sprintf("Changes Requested x%d", pr.changesRequested), jiraLabelColorYellow})
+		}
+		if pr.commented > 0 {
+			issue.labels = append(issue.labels, pageLabel{fmt.Sprintf("Commented x%d", pr.commented), jiraLabelColorGrey})
+		}
+		issues = append(issues, issue)
 	}
-
-	if !isFromTeam {
-		s += " " + formatLabelForHtmlOutput("Community", jiraLabelColorBlue)
+	if len(prs) > 0 {
+		w.quote(fmt.Sprintf("%d PRs reviewed, %d approvals, %d changes requested", len(prs), approved, changesRequested))
 	}
+	w.issues(issues)
+}
 
-	return s
+func (r *Reporter) genWeeklyReportOnCall(w pageWriter, start, end string) {
+	columns := []string{"key", "summary", "created", "updated", "assignee", "status"}
+	w.beginSection()
+
+	urgentJQL := r.config.Jira.urgentOnCallJQL()
+	w.heading(1, fmt.Sprintf("%s Priority", r.config.Jira.OnCallPriority))
+	w.quote(fmt.Sprintf("Unresolved OnCalls at or above %s priority (%s)", r.config.Jira.OnCallPriority, urgentJQL))
+	w.jiraIssues(columns, urgentJQL)
+
+	w.heading(1, "New OnCall")
+	w.quote(fmt.Sprintf("Newly created OnCalls (created >= %s AND created < %s)", start, end))
+	w.heading(3, "Operators")
+	w.lineBreak()
+	w.heading(3, "Summary")
+	w.placeholder("Please describe your update here")
+	w.heading(3, "Links")
+	w.jiraIssues(columns, r.config.Jira.newOnCallJQL(start, end))
+
+	w.endSection()
 }
 
-func formatGitHubIssuesForHtmlOutput(buf *bytes.Buffer, issues []github.Issue) {
-	if len(issues) == 0 {
-		buf.WriteString("<p><i>None</i></p>\n")
-		return
+func (r *Reporter) genWeeklyReportIssuesPRs(w pageWriter, start, end string, errs *reportErrors) {
+	var (
+		issues, prs       []github.Issue
+		issuesErr, prsErr error
+	)
+	r.runParallel(2, func(i int) {
+		if i == 0 {
+			issues, issuesErr = r.getCreatedIssues(&start, &end)
+		} else {
+			prs, prsErr = r.getMergedPullRequests(&start, &end)
+		}
+	})
+
+	w.beginSection()
+	w.heading(1, "New Issues")
+	w.quote(fmt.Sprintf("New GitHub issues (created: %s..%s)", start, end))
+	if issuesErr != nil {
+		errs.add("New Issues", issuesErr)
+		w.failure(issuesErr)
+	} else {
+		w.issues(r.newPageIssues(issues))
 	}
-	buf.WriteString("<ul>")
-	for _, issue := range issues {
-		buf.WriteString(fmt.Sprintf("<li>%s</li>\n", formatGitHubIssueForHtmlOutput(issue)))
+	w.heading(1, "Merged PRs")
+	w.quote(fmt.Sprintf("Merged GitHub PRs (merged: %s..%s)", start, end))
+	if prsErr != nil {
+		errs.add("Merged PRs", prsErr)
+		w.failure(prsErr)
+	} else {
+		w.issues(r.newPageIssues(prs))
 	}
-	buf.WriteString("</ul>")
-}
-
-func genPanelPlaceholder(buf *bytes.Buffer, desc string) {
-	panelTemplate := `
-    <ac:structured-macro ac:name="panel">
-    <ac:rich-text-body>
-      <p><ac:placeholder>%s</ac:placeholder></p>
-    </ac:rich-text-body>
-    </ac:structured-macro>`
-	buf.WriteString(fmt.Sprintf(panelTemplate, desc))
-}
-
-func genWeeklyUserPage(buf *bytes.Buffer, m Member, sprint *jira.Sprint) {
-	formatPageBeginForHtmlOutput(buf)
-
-	formatSectionBeginForHtmlOutput(buf)
-	buf.WriteString("\n<h3>Work</h3>\n")
-	buf.WriteString("\n<blockquote>A summary of my work in this week</blockquote>\n")
-	buf.WriteString("\n<p>Please fill this section</p>\n")
-	buf.WriteString("\n<h3>Next Week</h3>\n")
-	buf.WriteString("\n<blockquote>A plan of the next week</blockquote>\n")
-	buf.WriteString("\n<p>Please fill this section</p>\n")
-	formatSectionEndForHtmlOutput(buf)
-
-	formatSectionBeginForHtmlOutput(buf)
-	buf.WriteString("\n<h3>Issues in this week</h3>\n")
-	template := `
-<ac:structured-macro ac:name="jira">
-  <ac:parameter ac:name="columns">key,summary,created,updated,status</ac:parameter>
-  <ac:parameter ac:name="server">%s</ac:parameter>
-  <ac:parameter ac:name="serverId">%s</ac:parameter>
-  <ac:parameter ac:name="jqlQuery">project = %s AND Sprint = %d AND assignee = "%s"</ac:parameter>
-</ac:structured-macro>`
-	buf.WriteString(fmt.Sprintf(template, config.Jira.Server, config.Jira.ServerID, config.Jira.Project, sprint.ID, m.Email))
-	formatSectionEndForHtmlOutput(buf)
-
-	formatPageEndForHtmlOutput(buf)
-}
-
-func genReviewPullRequests(buf *bytes.Buffer, user, start, end string) {
-	buf.WriteString("<h3>Review PR</h3>")
-	issues := getReviewPullRequests(user, &start, &end)
-	formatGitHubIssuesForHtmlOutput(buf, issues)
-}
-
-func genWeeklyReportOnCall(buf *bytes.Buffer, start, end string) {
-	formatSectionBeginForHtmlOutput(buf)
-
-	buf.WriteString("\n<h1>Highest Priority</h1>\n")
-	buf.WriteString("\n<blockquote>Unresolved highest priority OnCalls (priority = Highest AND resolution = Unresolved)</blockquote>\n")
-	html := `
-<ac:structured-macro ac:name="jira">
-  <ac:parameter ac:name="columns">key,summary,created,updated,assignee,status</ac:parameter>
-  <ac:parameter ac:name="server">%s</ac:parameter>
-  <ac:parameter ac:name="serverId">%s</ac:parameter>
-  <ac:parameter ac:name="jqlQuery">project = %s AND priority = Highest AND resolution = Unresolved</ac:parameter>
-</ac:structured-macro>
-`
-	buf.WriteString(fmt.Sprintf(html, config.Jira.Server, config.Jira.ServerID, config.Jira.OnCall))
-
-	buf.WriteString("\n<h1>New OnCall</h1>\n")
-	buf.WriteString(fmt.Sprintf("\n<blockquote>Newly created OnCalls (created &gt;= %s AND created &lt; %s)</blockquote>\n", start, end))
-	buf.WriteString("\n<h3>Operators</h3>")
-	buf.WriteString("\n<br />")
-	buf.WriteString("\n<h3>Summary</h3>")
-	genPanelPlaceholder(buf, "Please describe your update here")
-	buf.WriteString("\n<h3>Links</h3>")
-	html = `
-<ac:structured-macro ac:name="jira">
-  <ac:parameter ac:name="columns">key,summary,created,updated,assignee,status</ac:parameter>
-  <ac:parameter ac:name="server">%s</ac:parameter>
-  <ac:parameter ac:name="serverId">%s</ac:parameter>
-  <ac:parameter ac:name="jqlQuery">project = %s AND created &gt;= %s AND created &lt; %s</ac:parameter>
-</ac:structured-macro>
-`
-	buf.WriteString(fmt.Sprintf(html, config.Jira.Server, config.Jira.ServerID, config.Jira.OnCall, start, end))
-
-	formatSectionEndForHtmlOutput(buf)
+	w.endSection()
 }
 
-func genWeeklyReportIssuesPRs(buf *bytes.Buffer, start, end string) {
-	formatSectionBeginForHtmlOutput(buf)
-	issues := getCreatedIssues(&start, &end)
-	buf.WriteString("\n<h1>New Issues</h1>\n")
-	buf.WriteString(fmt.Sprintf("\n<blockquote>New GitHub issues (created: %s..%s)</blockquote>\n", start, end))
-	formatGitHubIssuesForHtmlOutput(buf, issues)
-	prs := getMergedPullRequests(&start, &end)
-	buf.WriteString("\n<h1>Merged PRs</h1>\n")
-	buf.WriteString(fmt.Sprintf("\n<blockquote>Merged GitHub PRs (merged: %s..%s)</blockquote>\n", start, end))
-	formatGitHubIssuesForHtmlOutput(buf, prs)
-	formatSectionEndForHtmlOutput(buf)
-}
-
-func genWeeklyReportProjects(buf *bytes.Buffer, sprint *jira.Sprint) {
-	epicQuery := `project = %s and "Epic Link" is not EMPTY and Sprint = %d`
-	epicIssues := queryJiraIssues(fmt.Sprintf(epicQuery, config.Jira.Project, sprint.ID))
-	// An epic link set.
-	epics := make(map[string]struct{})
-	for _, is := range epicIssues {
-		// The magic name of epic link field.
-		const epicLinkField = "customfield_10100"
-		epicLink := is.Fields.Unknowns[epicLinkField].(string)
-		epics[epicLink] = struct{}{}
+func (r *Reporter) genWeeklyReportProjects(w pageWriter, sprint *jira.Sprint, errs *reportErrors) {
+	w.beginSection()
+	defer w.endSection()
+
+	fields := r.getJiraFields()
+	grouper := newEpicGrouper(fields.EpicLink)
+	err := r.iterateJiraIssues(fmt.Sprintf("project = %s AND Sprint = %d", r.config.Jira.Project, sprint.ID),
+		grouper.searchOptions(), grouper.add)
+	if err != nil {
+		errs.add("Projects", err)
+		w.failure(err)
+		return
 	}
 
-	projects := `
-  <table class="relative-table wrapped">
-    <tbody>
-    <tr>
-      <th>Name</th>
-      <th>Manager(*) &amp; Collaborators</th>
-      <th><p>Description</p></th>
-      <th><p>Links</p></th>
-    </tr>
-    %s
-    </tbody>
-  </table>`
-
-	descHolderBuf := bytes.Buffer{}
-	genPanelPlaceholder(&descHolderBuf, "Please describe your update here")
-
-	projectsBuf := bytes.Buffer{}
-	for ep := range epics {
-		epIssuesTemplate := `
-    <ac:structured-macro ac:name="jira">
-      <ac:parameter ac:name="columns">key,summary,assignee,created,updated,status</ac:parameter>
-      <ac:parameter ac:name="server">%s</ac:parameter>
-      <ac:parameter ac:name="serverId">%s</ac:parameter>
-      <ac:parameter ac:name="jqlQuery">project = %s and "Epic Link" = %s and Sprint = %d</ac:parameter>
-    </ac:structured-macro>`
-		epIssues := fmt.Sprintf(epIssuesTemplate,
-			config.Jira.Server, config.Jira.ServerID, config.Jira.Project, ep, sprint.ID)
-
-		projectTemplate := `
-    <tr>
-      <td>%s</td>
-      <td>%s</td>
-      <td>%s</td>
-      <td>
-        <ac:structured-macro ac:name="expand">
-        <ac:parameter ac:name="title">Issues</ac:parameter>
-        <ac:rich-text-body>
-        %s
-        </ac:rich-text-body>
-        </ac:structured-macro>
-      </td>
-    </tr>`
-
-		epic, _, err := jiraClient.Issue.Get(ep, nil)
-		perror(err)
-		// The magic name of epic name field.
-		const epicNameField = "customfield_10102"
-		epicName := html.EscapeString(epic.Fields.Unknowns[epicNameField].(string))
-		userTemplate := `<ac:link><ri:user ri:username="%s" /></ac:link>`
-		// Manager
-		participantsBuf := bytes.Buffer{}
-		participantsBuf.WriteString(fmt.Sprintf(userTemplate, epic.Fields.Assignee.Name) + "*")
-		// The magic name of collaborators field.
-		const collaboratorsField = "customfield_10949"
-		if field, ok := epic.Fields.Unknowns[collaboratorsField]; ok && field != nil {
-			for _, user := range field.([]interface{}) {
-				if user != nil {
-					name := user.(map[string]interface{})["name"].(string)
-					participantsBuf.WriteString("<br />")
-					participantsBuf.WriteString(fmt.Sprintf(userTemplate, name))
-				}
-			}
+	groups := r.groupIssuesByEpic(grouper, errs)
+	epics := make([]*jira.Issue, len(groups))
+	epicErrs := make([]error, len(groups))
+	r.runParallel(len(groups), func(i int) {
+		epics[i], epicErrs[i] = r.tracker.GetIssue(groups[i].key)
+	})
+
+	var projects []pageProject
+	for i, g := range groups {
+		ep := g.key
+		p := pageProject{key: ep, stories: g.stories}
+		if g.byParent {
+			p.jql = fmt.Sprintf(`project = %s and parent = %s and Sprint = %d`, r.config.Jira.Project, ep, sprint.ID)
+		} else {
+			p.jql = fmt.Sprintf(`project = %s and %s = %s and Sprint = %d`, r.config.Jira.Project,
+				jiraFieldJQL(fields.EpicLink, jiraFieldEpicLink), ep, sprint.ID)
 		}
-		projectsBuf.WriteString(fmt.Sprintf(projectTemplate,
-			epicName, participantsBuf.String(), descHolderBuf.String(), epIssues))
-	}
 
-	formatSectionBeginForHtmlOutput(buf)
-	buf.WriteString(fmt.Sprintf(projects, projectsBuf.String()))
-	formatSectionEndForHtmlOutput(buf)
-}
+		epic, err := epics[i], epicErrs[i]
+		if err != nil {
+			errs.add("Epic "+ep, err)
+			p.err = err
+			projects = append(projects, p)
+			continue
+		}
+		// Use the summary if the epic has no name.
+		p.name = jiraStringField(epic, fields.EpicName)
+		if len(p.name) == 0 && epic.Fields != nil {
+			p.name = epic.Fields.Summary
+		}
+		if epic.Fields != nil && epic.Fields.Assignee != nil {
+			p.manager = epic.Fields.Assignee.Name
+		}
+		p.collaborators = jiraUsersField(epic, fields.Collaborators)
+		projects = append(projects, p)
+	}
 
-func genWeeklyReportToc(buf *bytes.Buffer) {
-	formatSectionBeginForHtmlOutput(buf)
-
-	toc := `
-<ac:structured-macro ac:name="toc">
-  <ac:parameter ac:name="printable">true</ac:parameter>
-  <ac:parameter ac:name="style">square</ac:parameter>
-  <ac:parameter ac:name="maxLevel">2</ac:parameter>
-  <ac:parameter ac:name="class">bigpink</ac:parameter>
-  <ac:parameter ac:name="type">list</ac:parameter>
-</ac:structured-macro>
-	`
-	buf.WriteString(toc)
-
-	formatSectionEndForHtmlOutput(buf)
+	w.projects(projects)
 }
 
-func createWeeklyReport(sprint *jira.Sprint, value string) {
+func (r *Reporter) createWeeklyReport(sprint *jira.Sprint, value string, errs *reportErrors) error {
 	title := sprint.Name
-	space := config.Confluence.Space
-	c := getContentByTitle(space, title)
+	space := r.config.Confluence.Space
+	c, err := r.getContentByTitle(space, title)
+	if err != nil {
+		return err
+	}
 
 	if c.Id != "" {
-		c = updateContent(c, value)
+		if c, err = r.updateContent(c, value); err != nil {
+			return err
+		}
 	} else {
-		parent := getContentByTitle(space, config.Confluence.WeeklyPath)
-		c = createContent(space, parent.Id, title, value)
-		for _, team := range config.Teams {
-			for _, m := range team.Members {
-				body := bytes.Buffer{}
-				genWeeklyUserPage(&body, m, sprint)
-				userTitle := fmt.Sprintf("%s - %s", m.Name, title)
-				createContent(space, c.Id, userTitle, body.String())
-			}
+		parent, err := r.getContentByTitle(space, r.config.Confluence.WeeklyPath)
+		if err != nil {
+			return err
+		}
+		if c, err = r.createContent(space, parent.Id, title, value); err != nil {
+			return err
+		}
+		members := r.allTeamMembers()
+		prs := r.getMemberPullRequests(members, sprint)
+		for i, m := range members {
+			userTitle := fmt.Sprintf("%s - %s", m.Name, title)
+			w, _ := r.newPageWriter(outputConfluence, errs)
+			w.beginPage(userTitle)
+			r.genWeeklyUserPage(w, m, prs[i], sprint, errs)
+			w.endPage()
+			_, err = r.createContent(space, c.Id, userTitle, w.String())
+			errs.add(userTitle, err)
 		}
 	}
 
-	sendToSlack("Weekly report for sprint %s is generated: %s%s", title, config.Confluence.Endpoint, c.Links.WebUI)
+	return r.sendToSlack("Weekly report for sprint %s is generated: %s%s", title, r.config.Confluence.Endpoint, c.Links.WebUI)
 }